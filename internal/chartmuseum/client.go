@@ -0,0 +1,221 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const httpTimeout = 5 * time.Minute
+
+// Config is ChartMuseum server charts are uploaded to, requests are authenticated with the token (bearer) if it is
+// set, otherwise with the username and password (basic auth) if the username is set
+type Config struct {
+	// Url is ChartMuseum server url including context path e.g. https://charts.example.com
+	Url      string
+	Username string
+	Password string
+	Token    string
+}
+
+func (c Config) Enabled() bool {
+	return c.Url != ""
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("url: %q, username: %q, password: %s, token: %s", c.Url, c.Username, utils.SecretValue(c.Password), utils.SecretValue(c.Token))
+}
+
+type Client struct {
+	config      Config
+	baseUrl     string
+	httpClient  *http.Client
+	retryConfig utils.Retry
+	log         *zap.Logger
+}
+
+func NewClient(log *zap.Logger, config Config, retryConfig utils.Retry) (Client, error) {
+	u, err := url.Parse(config.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Client{}, fmt.Errorf("invalid chartmuseum url %q", config.Url)
+	}
+	return Client{
+		config:      config,
+		baseUrl:     strings.TrimSuffix(config.Url, "/"),
+		httpClient:  &http.Client{Timeout: httpTimeout},
+		retryConfig: retryConfig,
+		log:         log,
+	}, nil
+}
+
+// UploadedChart is chart uploaded to ChartMuseum, Existing is set if the chart version was already uploaded and it
+// was not replaced
+type UploadedChart struct {
+	Url      string
+	Existing bool
+}
+
+// Upload uploads packaged chart (and provenance file if the path is set). Chart version that already exists is skipped,
+// unless force is set, then it is replaced (ChartMuseum has to allow overwrite).
+func (c Client) Upload(name, version, archivePath, provenancePath string, force bool) (UploadedChart, error) {
+	body, contentType, err := multipartBody(archivePath, provenancePath)
+	if err != nil {
+		return UploadedChart{}, err
+	}
+	endpoint := c.baseUrl + "/api/charts"
+	if force {
+		endpoint += "?force"
+	}
+
+	ctx := context.Background()
+	uploaded := UploadedChart{Url: c.ChartUrl(filepath.Base(archivePath))}
+	err = c.retry(ctx, fmt.Sprintf("upload chart %s %s", name, version), func() error {
+		resp, err := c.do(ctx, http.MethodPost, endpoint, contentType, body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusConflict {
+			uploaded.Existing = true
+			return nil
+		}
+		return checkResponse(resp)
+	})
+	if err != nil {
+		return UploadedChart{}, fmt.Errorf("upload chart %s %s to chartmuseum: %w", name, version, err)
+	}
+	if uploaded.Existing {
+		c.log.Info(fmt.Sprintf("chart %s %s already exists in chartmuseum, skipping upload", name, version))
+		return uploaded, nil
+	}
+	c.log.Info(fmt.Sprintf("chart %s %s uploaded to %s", name, version, uploaded.Url))
+	return uploaded, nil
+}
+
+// Exists returns true if the chart version is already uploaded
+func (c Client) Exists(name, version string) (bool, error) {
+	ctx := context.Background()
+	endpoint := fmt.Sprintf("%s/api/charts/%s/%s", c.baseUrl, url.PathEscape(name), url.PathEscape(version))
+	var exists bool
+	err := c.retry(ctx, fmt.Sprintf("get chart %s %s", name, version), func() error {
+		resp, err := c.do(ctx, http.MethodGet, endpoint, "", nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			exists = false
+			return nil
+		}
+		if err := checkResponse(resp); err != nil {
+			return err
+		}
+		exists = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("get chart %s %s from chartmuseum: %w", name, version, err)
+	}
+	return exists, nil
+}
+
+// ChartUrl returns url the chart archive is served on by ChartMuseum
+func (c Client) ChartUrl(fileName string) string {
+	return fmt.Sprintf("%s/charts/%s", c.baseUrl, fileName)
+}
+
+func (c Client) do(ctx context.Context, method, endpoint, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case c.config.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	case c.config.Username != "":
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	return c.httpClient.Do(req)
+}
+
+// multipartBody returns multipart form with chart and prov files, as expected by ChartMuseum upload api
+func multipartBody(archivePath, provenancePath string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := addFormFile(w, "chart", archivePath); err != nil {
+		return nil, "", fmt.Errorf("read chart: %w", err)
+	}
+	if provenancePath != "" {
+		if err := addFormFile(w, "prov", provenancePath); err != nil {
+			return nil, "", fmt.Errorf("read provenance file: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+func addFormFile(w *multipart.Writer, field, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	part, err := w.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(b)
+	return err
+}
+
+// apiError is non-2xx ChartMuseum response
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// checkResponse returns api error if the response status is not 2xx, message is ChartMuseum json error body
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &apiError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+}
+
+// retry calls fn until it succeeds, returns error that is not transient or retries are exhausted
+func (c Client) retry(ctx context.Context, operation string, fn func() error) error {
+	return c.retryConfig.Do(ctx, c.log, operation, fn, isTransientError)
+}
+
+// isTransientError returns true for errors that can succeed on retry - server errors, throttling and network errors
+func isTransientError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests, 0
+	}
+	// network errors, timeouts ...
+	return true, 0
+}
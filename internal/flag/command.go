@@ -0,0 +1,115 @@
+package flag
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	CommandRelease = "release"
+	CommandPackage = "package"
+	CommandIndex   = "index"
+	CommandStatus  = "status"
+	CommandVersion = "version"
+	CommandVerify  = "verify"
+	CommandYank    = "yank"
+	CommandExport  = "export"
+	// CommandIndexRebuild is index command with rebuild argument
+	CommandIndexRebuild = "index rebuild"
+)
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	// args is set to true if the command accepts arguments (after flags)
+	args  bool
+	flags []func(flagSet *flag.FlagSet, f *flags)
+}
+
+var commands = []command{
+	{
+		name:        CommandRelease,
+		usage:       "[flags]",
+		description: "Package changed charts, create GitHub release for every chart and update GitHub pages index (default command)",
+		flags:       []func(*flag.FlagSet, *flags){globalFlags, chartsFlags, packageFlags, releaseFlags, tagFlags, ociFlags, chartMuseumFlags, s3Flags, retentionFlags, pageFlags, reproducibleFlags, concurrencyFlags, versionFlags},
+	},
+	{
+		name:        CommandPackage,
+		usage:       "[flags]",
+		description: "Package changed charts to the current directory",
+		flags:       []func(*flag.FlagSet, *flags){globalFlags, chartsFlags, packageFlags, ociFlags, chartMuseumFlags, s3Flags, reproducibleFlags, concurrencyFlags},
+	},
+	{
+		name:        CommandIndex,
+		usage:       "[flags] <packaged-chart>...",
+		description: "Create GitHub release for every packaged chart (.tgz) and update GitHub pages index",
+		args:        true,
+		flags:       []func(*flag.FlagSet, *flags){globalFlags, releaseFlags, tagFlags, ociFlags, chartMuseumFlags, s3Flags, retentionFlags, pageFlags, reproducibleFlags, concurrencyFlags},
+	},
+	{
+		name:        CommandIndexRebuild,
+		usage:       "[flags]",
+		description: "Rebuild GitHub pages index from charts (.tgz) uploaded to all GitHub releases",
+		flags:       []func(*flag.FlagSet, *flags){globalFlags, s3Flags, pageFlags, reproducibleFlags, concurrencyFlags},
+	},
+	{
+		name:        CommandStatus,
+		usage:       "[flags]",
+		description: "Print charts that would be released, skipped and removed from the index by retention policy",
+		flags:       []func(*flag.FlagSet, *flags){globalFlags, chartsFlags, ociFlags, chartMuseumFlags, s3Flags, retentionFlags},
+	},
+	{
+		name:        CommandVerify,
+		usage:       "[flags]",
+		description: "Verify that every index entry points at release asset with the same digest and every released chart is in the index",
+		flags:       []func(*flag.FlagSet, *flags){globalFlags, verifyFlags, s3Flags, concurrencyFlags},
+	},
+	{
+		name:        CommandYank,
+		usage:       "[flags] <chart> [version]",
+		description: "Remove chart version from GitHub pages index, or deprecate the whole chart",
+		args:        true,
+		flags:       []func(*flag.FlagSet, *flags){globalFlags, yankFlags, tagFlags, s3Flags, pageFlags, reproducibleFlags},
+	},
+	{
+		name:        CommandExport,
+		usage:       "[flags]",
+		description: "Package all charts and write them with index.yaml to a directory or tarball, git remote and GitHub are not used",
+		flags:       []func(*flag.FlagSet, *flags){exportFlags, packageFlags, reproducibleFlags, concurrencyFlags},
+	},
+	{
+		name:        CommandVersion,
+		usage:       "",
+		description: "Print hcr version",
+	},
+}
+
+func getCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for command flags.\n", os.Args[0])
+}
+
+func printCommandUsage(flagSet *flag.FlagSet, cmd command) {
+	w := flagSet.Output()
+	fmt.Fprintf(w, "Usage of %s %s %s\n%s\n\nFlags:\n", os.Args[0], cmd.name, cmd.usage, cmd.description)
+	flagSet.PrintDefaults()
+	if cmd.name == CommandRelease {
+		fmt.Fprintln(w)
+		printUsage(w)
+	}
+}
@@ -0,0 +1,317 @@
+package flag
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/hcr"
+	"github.com/pete911/hcr/internal/helm"
+	"github.com/pete911/hcr/internal/oci"
+	"github.com/pete911/hcr/internal/s3"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"slices"
+	"strings"
+	"time"
+)
+
+// configFileName is config file discovered in the current directory or its parents (up to the git repository root)
+const configFileName = ".hcr.yaml"
+
+// fileConfig is config file content, it sets defaults for the flags, flags and env. variables take precedence
+type fileConfig struct {
+	PagesBranch          string                     `json:"pagesBranch"`
+	Remote               string                     `json:"remote"`
+	Backend              string                     `json:"backend"`
+	ApiUrl               string                     `json:"apiUrl"`
+	Retries              *int                       `json:"retries"`
+	RetryBackoff         string                     `json:"retryBackoff"`
+	ChartsDir            string                     `json:"chartsDir"`
+	HelmSign             *bool                      `json:"helmSign"`
+	HelmKey              string                     `json:"helmKey"`
+	HelmKeyring          string                     `json:"helmKeyring"`
+	HelmPassphraseFile   string                     `json:"helmPassphraseFile"`
+	HelmDependency       string                     `json:"helmDependency"`
+	HelmRepositoryConfig string                     `json:"helmRepositoryConfig"`
+	HelmRepositoryCache  string                     `json:"helmRepositoryCache"`
+	Lint                 *bool                      `json:"lint"`
+	LintStrict           *bool                      `json:"lintStrict"`
+	Concurrency          *int                       `json:"concurrency"`
+	PreRelease           *bool                      `json:"preRelease"`
+	Tag                  string                     `json:"tag"`
+	Force                *bool                      `json:"force"`
+	ForceStable          *bool                      `json:"forceStable"`
+	Retention            retentionFileConfig        `json:"retention"`
+	Page                 *bool                      `json:"page"`
+	PageTemplate         string                     `json:"pageTemplate"`
+	PagesUrl             string                     `json:"pagesUrl"`
+	ArtifactHub          artifactHubFileConfig      `json:"artifactHub"`
+	OCI                  ociFileConfig              `json:"oci"`
+	ChartMuseum          chartMuseumFileConfig      `json:"chartMuseum"`
+	S3                   s3FileConfig               `json:"s3"`
+	Export               exportFileConfig           `json:"export"`
+	Reproducible         *bool                      `json:"reproducible"`
+	Charts               map[string]chartFileConfig `json:"charts"`
+}
+
+// retentionFileConfig configures which chart versions are kept in the index
+type retentionFileConfig struct {
+	KeepLast         *int   `json:"keepLast"`
+	KeepLatestPer    string `json:"keepLatestPer"`
+	PreReleaseMaxAge string `json:"preReleaseMaxAge"`
+	DeleteReleases   *bool  `json:"deleteReleases"`
+}
+
+// artifactHubFileConfig is Artifact Hub repository metadata (artifacthub-repo.yml) and changes annotation config
+type artifactHubFileConfig struct {
+	RepositoryId string                  `json:"repositoryID"`
+	Owners       []hcr.ArtifactHubOwner  `json:"owners"`
+	Ignore       []hcr.ArtifactHubIgnore `json:"ignore"`
+	Changes      *bool                   `json:"changes"`
+}
+
+// ociFileConfig is OCI registry charts are pushed to, credentials are set by flags or env. variables only
+type ociFileConfig struct {
+	Registry  string `json:"registry"`
+	PlainHTTP *bool  `json:"plainHTTP"`
+	Only      *bool  `json:"only"`
+}
+
+// chartMuseumFileConfig is ChartMuseum charts are uploaded to, credentials are set by flags or env. variables only
+type chartMuseumFileConfig struct {
+	Url  string `json:"url"`
+	Only *bool  `json:"only"`
+}
+
+// s3FileConfig is S3-compatible bucket charts and index are uploaded to, credentials are set by flags or env. variables
+// only
+type s3FileConfig struct {
+	Url       string `json:"url"`
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	PathStyle *bool  `json:"pathStyle"`
+	PublicUrl string `json:"publicUrl"`
+}
+
+// exportFileConfig is directory or tarball charts and index are written to by export command
+type exportFileConfig struct {
+	Out     string `json:"out"`
+	BaseUrl string `json:"baseUrl"`
+}
+
+// chartFileConfig overrides global config for the chart
+type chartFileConfig struct {
+	Tag         string   `json:"tag"`
+	PreRelease  *bool    `json:"preRelease"`
+	HelmKey     string   `json:"helmKey"`
+	Description string   `json:"description"`
+	ExtraAssets []string `json:"extraAssets"`
+	ValuesFiles []string `json:"valuesFiles"`
+	Skip        bool     `json:"skip"`
+	Force       bool     `json:"force"`
+	ForceStable bool     `json:"forceStable"`
+}
+
+// loadFileConfig loads config file from the path. If the path is empty, config file is discovered in the current
+// directory or its parents and if it is not found, empty config is returned.
+func loadFileConfig(path string) (fileConfig, error) {
+	if path == "" {
+		path = findConfigFile()
+		if path == "" {
+			return fileConfig{}, nil
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fileConfig{}, fmt.Errorf("read config file: %w", err)
+	}
+	var fc fileConfig
+	if err := yaml.UnmarshalStrict(b, &fc); err != nil {
+		return fileConfig{}, fmt.Errorf("config file %s: %w", path, err)
+	}
+	if err := fc.validate(); err != nil {
+		return fileConfig{}, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return fc, nil
+}
+
+// validate validates config file values, returned error contains the invalid key
+func (fc fileConfig) validate() error {
+	if fc.Backend != "" && !slices.Contains(forge.Backends, fc.Backend) {
+		return fmt.Errorf("backend: %q is not valid, expected one of %s", fc.Backend, strings.Join(forge.Backends, ", "))
+	}
+	if fc.Retries != nil && *fc.Retries < 0 {
+		return errors.New("retries: cannot be negative")
+	}
+	if fc.RetryBackoff != "" {
+		if _, err := time.ParseDuration(fc.RetryBackoff); err != nil {
+			return fmt.Errorf("retryBackoff: %w", err)
+		}
+	}
+	if fc.HelmDependency != "" && !slices.Contains(helm.DependencyModes, fc.HelmDependency) {
+		return fmt.Errorf("helmDependency: %q is not valid, expected one of %s", fc.HelmDependency, strings.Join(helm.DependencyModes, ", "))
+	}
+	if fc.Concurrency != nil && *fc.Concurrency < 1 {
+		return errors.New("concurrency: has to be greater than 0")
+	}
+	if err := hcr.ValidateTagTemplate(fc.Tag); err != nil {
+		return fmt.Errorf("tag: %w", err)
+	}
+	if fc.Retention.KeepLast != nil && *fc.Retention.KeepLast < 0 {
+		return errors.New("retention.keepLast: cannot be negative")
+	}
+	if fc.Retention.KeepLatestPer != "" && !slices.Contains(helm.KeepLatestPer, fc.Retention.KeepLatestPer) {
+		return fmt.Errorf("retention.keepLatestPer: %q is not valid, expected one of %s", fc.Retention.KeepLatestPer, strings.Join(helm.KeepLatestPer, ", "))
+	}
+	if fc.Retention.PreReleaseMaxAge != "" {
+		if _, err := time.ParseDuration(fc.Retention.PreReleaseMaxAge); err != nil {
+			return fmt.Errorf("retention.preReleaseMaxAge: %w", err)
+		}
+	}
+	for i, owner := range fc.ArtifactHub.Owners {
+		if owner.Email == "" {
+			return fmt.Errorf("artifactHub.owners[%d].email: cannot be empty", i)
+		}
+	}
+	for i, ignore := range fc.ArtifactHub.Ignore {
+		if ignore.Name == "" {
+			return fmt.Errorf("artifactHub.ignore[%d].name: cannot be empty", i)
+		}
+	}
+	if fc.OCI.Registry != "" && !strings.HasPrefix(fc.OCI.Registry, oci.Scheme) {
+		return fmt.Errorf("oci.registry: %q has to start with %s", fc.OCI.Registry, oci.Scheme)
+	}
+	if fc.ChartMuseum.Url != "" && !strings.HasPrefix(fc.ChartMuseum.Url, "http://") && !strings.HasPrefix(fc.ChartMuseum.Url, "https://") {
+		return fmt.Errorf("chartMuseum.url: %q has to start with http:// or https://", fc.ChartMuseum.Url)
+	}
+	if fc.S3.Url != "" {
+		if _, _, err := (s3.Config{Url: fc.S3.Url}).BucketAndPrefix(); err != nil {
+			return fmt.Errorf("s3.url: %w", err)
+		}
+	}
+	for name, chartConfig := range fc.Charts {
+		if err := hcr.ValidateTagTemplate(chartConfig.Tag); err != nil {
+			return fmt.Errorf("charts.%s.tag: %w", name, err)
+		}
+		for i, extraAsset := range chartConfig.ExtraAssets {
+			if extraAsset == "" {
+				return fmt.Errorf("charts.%s.extraAssets[%d]: cannot be empty", name, i)
+			}
+		}
+		for i, valuesFile := range chartConfig.ValuesFiles {
+			if valuesFile == "" {
+				return fmt.Errorf("charts.%s.valuesFiles[%d]: cannot be empty", name, i)
+			}
+		}
+	}
+	return nil
+}
+
+func (fc fileConfig) retryBackoff() time.Duration {
+	// already validated
+	d, _ := time.ParseDuration(fc.RetryBackoff)
+	return d
+}
+
+func (fc fileConfig) preReleaseMaxAge() time.Duration {
+	// already validated
+	d, _ := time.ParseDuration(fc.Retention.PreReleaseMaxAge)
+	return d
+}
+
+func (fc fileConfig) chartsConfig() map[string]hcr.ChartConfig {
+	charts := make(map[string]hcr.ChartConfig)
+	for name, chartConfig := range fc.Charts {
+		charts[name] = hcr.ChartConfig{
+			Tag:         chartConfig.Tag,
+			PreRelease:  chartConfig.PreRelease,
+			Description: chartConfig.Description,
+			ExtraAssets: chartConfig.ExtraAssets,
+			ValuesFiles: chartConfig.ValuesFiles,
+			Skip:        chartConfig.Skip,
+			Force:       chartConfig.Force,
+			ForceStable: chartConfig.ForceStable,
+		}
+	}
+	return charts
+}
+
+func (fc fileConfig) chartKeys() map[string]string {
+	keys := make(map[string]string)
+	for name, chartConfig := range fc.Charts {
+		if chartConfig.HelmKey != "" {
+			keys[name] = chartConfig.HelmKey
+		}
+	}
+	return keys
+}
+
+// findConfigFile looks for config file in the current directory and its parents, up to the git repository root
+func findConfigFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		// repository root
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configFilePath returns config file path set by -config flag (flags are not parsed yet) or HCR_CONFIG env. variable
+func configFilePath(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return getStringEnv("HCR_CONFIG", "")
+}
+
+func orString(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func orBool(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+func orInt(value *int, defaultValue int) int {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+func orDuration(value, defaultValue time.Duration) time.Duration {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
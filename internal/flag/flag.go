@@ -3,85 +3,475 @@ package flag
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"github.com/pete911/hcr/internal/chartmuseum"
+	"github.com/pete911/hcr/internal/forge"
 	"github.com/pete911/hcr/internal/hcr"
 	"github.com/pete911/hcr/internal/helm"
+	"github.com/pete911/hcr/internal/oci"
+	"github.com/pete911/hcr/internal/s3"
+	"github.com/pete911/hcr/internal/utils"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type flags struct {
-	pagesBranch        string
-	chartsDir          string
-	helmSign           bool
-	helmKey            string
-	helmKeyring        string
-	helmPassphraseFile string
-	preRelease         bool
-	tag                string
-	remote             string
-	token              string
-	dryRun             bool
-	version            bool
-}
-
-func ParseFlags() (hcr.Config, error) {
-	flagSet := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
-	var f flags
-
-	flagSet.StringVar(&f.pagesBranch, "pages-branch", getStringEnv("HCR_PAGES_BRANCH", "gh-pages"), "The GitHub pages branch")
-	flagSet.StringVar(&f.chartsDir, "charts-dir", getStringEnv("HCR_CHARTS_DIR", "charts"), "The Helm charts location, can be specific chart")
-	flagSet.BoolVar(&f.helmSign, "helm-sign", getBoolEnv("HCR_HELM_SIGN", false), "Use a PGP private key to sign this package")
-	flagSet.StringVar(&f.helmKey, "helm-key", getStringEnv("HCR_HELM_KEY", ""), "Name of the key to use when signing. Used if --sign is true")
-	flagSet.StringVar(&f.helmKeyring, "helm-keyring", getStringEnv("HCR_HELM_KEYRING", ""), "Location of a public keyring")
-	flagSet.StringVar(&f.helmKeyring, "helm-passphrase-file", getStringEnv("HCR_HELM_PASSPHRASE_FILE", ""), "Location of a file which contains the passphrase for the signing key")
-	flagSet.BoolVar(&f.preRelease, "pre-release", getBoolEnv("HCR_PRE_RELEASE", false), "Whether the (chart) release should be marked as pre-release")
-	flagSet.StringVar(&f.tag, "tag", getStringEnv("HCR_TAG", ""), "Release tag, defaults to chart version")
-	flagSet.StringVar(&f.remote, "remote", getStringEnv("HCR_REMOTE", "origin"), "The Git remote for the GitHub Pages branch")
-	flagSet.StringVar(&f.token, "token", getStringEnv("HCR_TOKEN", ""), "GitHub Auth Token")
-	flagSet.BoolVar(&f.dryRun, "dry-run", getBoolEnv("HCR_DRY_RUN", false), "Whether to skip release update gh-pages index update")
-	flagSet.BoolVar(&f.version, "version", getBoolEnv("HCR_VERSION", false), "Print hcr version")
+	config              string
+	file                fileConfig
+	pagesBranch         string
+	chartsDir           string
+	since               string
+	helmSign            bool
+	helmKey             string
+	helmKeyring         string
+	helmPassphraseFile  string
+	helmDependency      string
+	helmRepoConfig      string
+	helmRepoCache       string
+	lint                bool
+	lintStrict          bool
+	concurrency         int
+	preRelease          bool
+	tag                 string
+	force               bool
+	forceStable         bool
+	yankDeprecate       bool
+	yankPreRelease      bool
+	yankNotice          string
+	remote              string
+	backend             string
+	apiUrl              string
+	token               string
+	retries             int
+	retryBackoff        time.Duration
+	dryRun              bool
+	keepLast            int
+	keepLatestPer       string
+	preReleaseMaxAge    time.Duration
+	deleteReleases      bool
+	page                bool
+	pageTemplate        string
+	pagesUrl            string
+	artifactHubRepoId   string
+	artifactHubChanges  bool
+	ociRegistry         string
+	ociUsername         string
+	ociPassword         string
+	ociPlainHttp        bool
+	ociOnly             bool
+	chartMuseumUrl      string
+	chartMuseumUsername string
+	chartMuseumPassword string
+	chartMuseumToken    string
+	chartMuseumOnly     bool
+	s3Url               string
+	s3Endpoint          string
+	s3Region            string
+	s3AccessKey         string
+	s3SecretKey         string
+	s3PathStyle         bool
+	s3PublicUrl         string
+	exportOut           string
+	exportBaseUrl       string
+	reproducible        bool
+	reportFile          string
+	reportFormat        string
+	version             bool
+}
+
+// ParseFlags parses command (first argument) and its flags. If the first argument is a flag, release command is used.
+func ParseFlags() (string, hcr.Config, error) {
+	name, args := CommandRelease, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	// index rebuild is a separate command, index command arguments are packaged charts
+	if name == CommandIndex && len(args) > 0 && args[0] == "rebuild" {
+		name, args = CommandIndexRebuild, args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stderr)
+		return "", hcr.Config{}, flag.ErrHelp
+	}
+
+	cmd, ok := getCommand(name)
+	if !ok {
+		printUsage(os.Stderr)
+		return "", hcr.Config{}, fmt.Errorf("unknown command %q", name)
+	}
+
+	// config file sets flags defaults, so it has to be loaded before flags are registered
+	file, err := loadFileConfig(configFilePath(args))
+	if err != nil {
+		return "", hcr.Config{}, err
+	}
+
+	flagSet := flag.NewFlagSet(fmt.Sprintf("%s %s", os.Args[0], cmd.name), flag.ContinueOnError)
+	flagSet.Usage = func() { printCommandUsage(flagSet, cmd) }
+	f := flags{file: file}
+	for _, register := range cmd.flags {
+		register(flagSet, &f)
+	}
 
-	if err := flagSet.Parse(os.Args[1:]); err != nil {
-		return hcr.Config{}, err
+	if err := flagSet.Parse(args); err != nil {
+		return "", hcr.Config{}, err
+	}
+	if !cmd.args && flagSet.NArg() > 0 {
+		return "", hcr.Config{}, fmt.Errorf("%s command does not accept arguments: %s", cmd.name, strings.Join(flagSet.Args(), " "))
 	}
 
-	if err := f.validate(); err != nil {
-		return hcr.Config{}, err
+	if err := f.validate(flagSet); err != nil {
+		return "", hcr.Config{}, err
+	}
+	sourceDateEpoch, err := f.sourceDateEpoch()
+	if err != nil {
+		return "", hcr.Config{}, err
+	}
+	var yank hcr.YankConfig
+	if cmd.name == CommandYank {
+		if yank, err = f.yankConfig(flagSet.Args()); err != nil {
+			return "", hcr.Config{}, err
+		}
 	}
 
 	helmConfig := helm.Config{
-		Sign:           f.helmSign,
-		Key:            f.helmKey,
-		Keyring:        f.helmKeyring,
-		PassphraseFile: f.helmPassphraseFile,
-	}
-
-	return hcr.Config{
-		PagesBranch: f.pagesBranch,
-		ChartsDir:   f.chartsDir,
-		HelmConfig:  helmConfig,
-		PreRelease:  f.preRelease,
-		Tag:         f.tag,
-		Remote:      f.remote,
-		Token:       f.token,
-		DryRun:      f.dryRun,
-		Version:     f.version,
+		Sign:             f.helmSign,
+		Key:              f.helmKey,
+		Keyring:          f.helmKeyring,
+		PassphraseFile:   f.helmPassphraseFile,
+		Dependency:       f.helmDependency,
+		RepositoryConfig: f.helmRepoConfig,
+		RepositoryCache:  f.helmRepoCache,
+		ChartKeys:        f.file.chartKeys(),
+		Retention: helm.Retention{
+			KeepLast:         f.keepLast,
+			KeepLatestPer:    f.keepLatestPer,
+			PreReleaseMaxAge: f.preReleaseMaxAge,
+		},
+		Reproducible: f.reproducible,
+	}
+
+	return cmd.name, hcr.Config{
+		PagesBranch:          f.pagesBranch,
+		ChartsDir:            f.chartsDir,
+		Since:                f.since,
+		HelmConfig:           helmConfig,
+		Lint:                 f.lint,
+		LintStrict:           f.lintStrict,
+		Concurrency:          f.concurrency,
+		PreRelease:           f.preRelease,
+		Tag:                  f.tag,
+		Force:                f.force,
+		ForceStable:          f.forceStable,
+		Remote:               f.remote,
+		Backend:              f.backend,
+		ApiUrl:               f.apiUrl,
+		Token:                f.token,
+		Retry:                utils.Retry{Retries: f.retries, Backoff: f.retryBackoff},
+		DryRun:               f.dryRun,
+		DeletePrunedReleases: f.deleteReleases,
+		Page:                 f.page,
+		PageTemplate:         f.pageTemplate,
+		PagesUrl:             f.pagesUrl,
+		ArtifactHub: hcr.ArtifactHubConfig{
+			RepositoryId: f.artifactHubRepoId,
+			Owners:       f.file.ArtifactHub.Owners,
+			Ignore:       f.file.ArtifactHub.Ignore,
+			Changes:      f.artifactHubChanges,
+		},
+		OCI: oci.Config{
+			Registry:  f.ociRegistry,
+			Username:  f.ociUsername,
+			Password:  f.ociPassword,
+			PlainHTTP: f.ociPlainHttp,
+		},
+		OCIOnly: f.ociOnly,
+		ChartMuseum: chartmuseum.Config{
+			Url:      f.chartMuseumUrl,
+			Username: f.chartMuseumUsername,
+			Password: f.chartMuseumPassword,
+			Token:    f.chartMuseumToken,
+		},
+		ChartMuseumOnly: f.chartMuseumOnly,
+		S3: s3.Config{
+			Url:          f.s3Url,
+			Endpoint:     f.s3Endpoint,
+			Region:       f.s3Region,
+			AccessKey:    f.s3AccessKey,
+			SecretKey:    f.s3SecretKey,
+			SessionToken: getStringEnv("AWS_SESSION_TOKEN", ""),
+			PathStyle:    f.s3PathStyle,
+			PublicUrl:    f.s3PublicUrl,
+		},
+		Reproducible:    f.reproducible,
+		SourceDateEpoch: sourceDateEpoch,
+		Version:         f.version,
+		ReportFile:      f.reportFile,
+		ReportFormat:    f.reportFormat,
+		Yank:            yank,
+		Export:          hcr.ExportConfig{Out: f.exportOut, BaseUrl: f.exportBaseUrl},
+		PackagedCharts:  flagSet.Args(),
+		Charts:          f.file.chartsConfig(),
 	}, nil
 }
 
-func (f flags) validate() error {
-	if f.pagesBranch == "" {
+// globalFlags are flags shared by all the commands working with GitHub pages
+func globalFlags(flagSet *flag.FlagSet, f *flags) {
+	commonFlags(flagSet, f)
+	flagSet.StringVar(&f.pagesBranch, "pages-branch", getStringEnv("HCR_PAGES_BRANCH", orString(f.file.PagesBranch, "gh-pages")), "The GitHub pages branch")
+	flagSet.StringVar(&f.remote, "remote", getStringEnv("HCR_REMOTE", orString(f.file.Remote, "origin")), "The Git remote for the GitHub Pages branch")
+	flagSet.StringVar(&f.backend, "backend", getStringEnv("HCR_BACKEND", orString(f.file.Backend, forge.Auto)), fmt.Sprintf("Git hosting service charts are released to, one of %s, auto detects it from the remote url", strings.Join(forge.Backends, ", ")))
+	flagSet.StringVar(&f.apiUrl, "api-url", getStringEnv("HCR_API_URL", f.file.ApiUrl), "API url of GitHub Enterprise Server, self-hosted GitLab or Gitea, defaults to the public API, https://<remote host>/api/v4 for GitLab or https://<remote host>/api/v1 for Gitea")
+	flagSet.StringVar(&f.token, "token", getStringEnv("HCR_TOKEN", ""), "GitHub, GitLab or Gitea Auth Token")
+	flagSet.IntVar(&f.retries, "retries", getIntEnv("HCR_RETRIES", orInt(f.file.Retries, 3)), "Number of retries of failed GitHub API calls and rejected GitHub pages pushes")
+	flagSet.DurationVar(&f.retryBackoff, "retry-backoff", getDurationEnv("HCR_RETRY_BACKOFF", orDuration(f.file.retryBackoff(), 2*time.Second)), "Initial wait before retry, doubled after every retry")
+	flagSet.BoolVar(&f.dryRun, "dry-run", getBoolEnv("HCR_DRY_RUN", false), "Whether to skip release update gh-pages index update")
+}
+
+// commonFlags are flags shared by all the commands
+func commonFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.StringVar(&f.config, "config", getStringEnv("HCR_CONFIG", ""), fmt.Sprintf("Config file, defaults to %s in the current directory or its parents", configFileName))
+	flagSet.StringVar(&f.reportFile, "report-file", getStringEnv("HCR_REPORT_FILE", ""), "Write report to the file instead of stdout")
+	flagSet.StringVar(&f.reportFormat, "report-format", getStringEnv("HCR_REPORT_FORMAT", hcr.ReportFormatJSON), fmt.Sprintf("Report format, one of %s", strings.Join(hcr.ReportFormats, ", ")))
+}
+
+// reproducibleFlags are flags for commands that package charts or write GitHub pages index
+func reproducibleFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.BoolVar(&f.reproducible, "reproducible", getBoolEnv("HCR_REPRODUCIBLE", orBool(f.file.Reproducible, false)), "Whether to use SOURCE_DATE_EPOCH or chart last commit time instead of the current time for chart archives and index timestamps")
+}
+
+// chartsFlags are flags for commands working with charts source
+func chartsFlags(flagSet *flag.FlagSet, f *flags) {
+	chartsDirFlags(flagSet, f)
+	flagSet.StringVar(&f.since, "since", getStringEnv("HCR_SINCE", ""), "Git ref, release only charts changed since this ref")
+}
+
+func chartsDirFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.StringVar(&f.chartsDir, "charts-dir", getStringEnv("HCR_CHARTS_DIR", orString(f.file.ChartsDir, "charts")), "The Helm charts location, can be specific chart")
+}
+
+// exportFlags are flags for export command, it does not use git remote and GitHub pages, so global flags are not set
+func exportFlags(flagSet *flag.FlagSet, f *flags) {
+	commonFlags(flagSet, f)
+	chartsDirFlags(flagSet, f)
+	flagSet.StringVar(&f.exportOut, "out", getStringEnv("HCR_OUT", f.file.Export.Out), "Directory, or tarball if it ends with .tgz or .tar.gz, charts and index.yaml are written to")
+	flagSet.StringVar(&f.exportBaseUrl, "base-url", getStringEnv("HCR_BASE_URL", f.file.Export.BaseUrl), "Url the exported repository is served on, used for chart urls in the index, urls are relative to the index if it is not set")
+}
+
+// packageFlags are flags for commands that package charts
+func packageFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.BoolVar(&f.helmSign, "helm-sign", getBoolEnv("HCR_HELM_SIGN", orBool(f.file.HelmSign, false)), "Use a PGP private key to sign this package")
+	flagSet.StringVar(&f.helmKey, "helm-key", getStringEnv("HCR_HELM_KEY", f.file.HelmKey), "Name of the key to use when signing. Used if --sign is true")
+	flagSet.StringVar(&f.helmKeyring, "helm-keyring", getStringEnv("HCR_HELM_KEYRING", f.file.HelmKeyring), "Location of a public keyring")
+	flagSet.StringVar(&f.helmPassphraseFile, "helm-passphrase-file", getStringEnv("HCR_HELM_PASSPHRASE_FILE", f.file.HelmPassphraseFile), "Location of a file which contains the passphrase for the signing key")
+	flagSet.StringVar(&f.helmDependency, "helm-dependency", getStringEnv("HCR_HELM_DEPENDENCY", orString(f.file.HelmDependency, helm.DependencyBuild)), fmt.Sprintf("How to resolve chart dependencies before packaging, one of %s", strings.Join(helm.DependencyModes, ", ")))
+	flagSet.StringVar(&f.helmRepoConfig, "helm-repository-config", getStringEnv("HCR_HELM_REPOSITORY_CONFIG", f.file.HelmRepositoryConfig), "Path to the file containing repository names and URLs, defaults to helm repositories config")
+	flagSet.StringVar(&f.helmRepoCache, "helm-repository-cache", getStringEnv("HCR_HELM_REPOSITORY_CACHE", f.file.HelmRepositoryCache), "Path to the directory containing cached repository indexes, defaults to helm repository cache")
+	flagSet.BoolVar(&f.lint, "lint", getBoolEnv("HCR_LINT", orBool(f.file.Lint, false)), "Whether to lint and render charts before release, release is aborted if any chart fails")
+	flagSet.BoolVar(&f.lintStrict, "lint-strict", getBoolEnv("HCR_LINT_STRICT", orBool(f.file.LintStrict, false)), "Whether lint warnings should fail the release as well")
+	flagSet.BoolVar(&f.artifactHubChanges, "artifacthub-changes", getBoolEnv("HCR_ARTIFACTHUB_CHANGES", orBool(f.file.ArtifactHub.Changes, false)), "Whether to add artifacthub.io/changes annotation generated from git history to packaged charts")
+}
+
+// releaseFlags are flags for commands that create GitHub releases
+func releaseFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.BoolVar(&f.preRelease, "pre-release", getBoolEnv("HCR_PRE_RELEASE", orBool(f.file.PreRelease, false)), "Whether the (chart) release should be marked as pre-release")
+	flagSet.BoolVar(&f.force, "force", getBoolEnv("HCR_FORCE", orBool(f.file.Force, false)), "Whether to re-release already released pre-release versions, release asset and index entry are replaced")
+	flagSet.BoolVar(&f.forceStable, "force-stable", getBoolEnv("HCR_FORCE_STABLE", orBool(f.file.ForceStable, false)), "Whether force applies to not pre-release versions as well")
+}
+
+// tagFlags are flags for commands that work with GitHub releases of the charts
+func tagFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.StringVar(&f.tag, "tag", getStringEnv("HCR_TAG", f.file.Tag), "Release tag template e.g. '{{ .Name }}-{{ .Version }}', defaults to chart version")
+}
+
+// yankFlags are flags for yank command
+func yankFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.BoolVar(&f.yankDeprecate, "deprecate", getBoolEnv("HCR_DEPRECATE", false), "Whether to mark the whole chart as deprecated instead of removing the version from the index")
+	flagSet.BoolVar(&f.yankPreRelease, "mark-pre-release", getBoolEnv("HCR_MARK_PRE_RELEASE", false), "Whether to mark the chart version GitHub release as pre-release")
+	flagSet.StringVar(&f.yankNotice, "notice", getStringEnv("HCR_NOTICE", ""), "Notice prepended to the chart version GitHub release body e.g. '**Yanked**: broken upgrade'")
+}
+
+// pageFlags are flags for commands that commit GitHub pages index
+func pageFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.BoolVar(&f.page, "page", getBoolEnv("HCR_PAGE", orBool(f.file.Page, false)), "Whether to render index.html landing page with all the charts to GitHub pages")
+	flagSet.StringVar(&f.pageTemplate, "page-template", getStringEnv("HCR_PAGE_TEMPLATE", f.file.PageTemplate), "Go html template file used to render index.html, defaults to built-in template")
+	flagSet.StringVar(&f.artifactHubRepoId, "artifacthub-repository-id", getStringEnv("HCR_ARTIFACTHUB_REPOSITORY_ID", f.file.ArtifactHub.RepositoryId), "Artifact Hub repository ID written to artifacthub-repo.yml in GitHub pages")
+	flagSet.StringVar(&f.pagesUrl, "pages-url", getStringEnv("HCR_PAGES_URL", f.file.PagesUrl), "The GitHub pages url used in index.html, defaults to https://<owner>.github.io/<repo>")
+}
+
+// ociFlags are flags for commands that push charts to OCI registry
+func ociFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.StringVar(&f.ociRegistry, "oci-registry", getStringEnv("HCR_OCI_REGISTRY", f.file.OCI.Registry), "OCI registry charts are pushed to e.g. oci://ghcr.io/owner/charts")
+	flagSet.StringVar(&f.ociUsername, "oci-username", getStringEnv("HCR_OCI_USERNAME", ""), "OCI registry username, defaults to credentials stored by helm registry login")
+	flagSet.StringVar(&f.ociPassword, "oci-password", getStringEnv("HCR_OCI_PASSWORD", ""), "OCI registry password")
+	flagSet.BoolVar(&f.ociPlainHttp, "oci-plain-http", getBoolEnv("HCR_OCI_PLAIN_HTTP", orBool(f.file.OCI.PlainHTTP, false)), "Whether to use plain http for OCI registry")
+	flagSet.BoolVar(&f.ociOnly, "oci-only", getBoolEnv("HCR_OCI_ONLY", orBool(f.file.OCI.Only, false)), "Whether to push charts to OCI registry only, without GitHub releases and GitHub pages index")
+}
+
+// chartMuseumFlags are flags for commands that upload charts to ChartMuseum
+func chartMuseumFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.StringVar(&f.chartMuseumUrl, "chartmuseum-url", getStringEnv("HCR_CHARTMUSEUM_URL", f.file.ChartMuseum.Url), "ChartMuseum url charts are uploaded to e.g. https://charts.example.com")
+	flagSet.StringVar(&f.chartMuseumUsername, "chartmuseum-username", getStringEnv("HCR_CHARTMUSEUM_USERNAME", ""), "ChartMuseum basic auth username")
+	flagSet.StringVar(&f.chartMuseumPassword, "chartmuseum-password", getStringEnv("HCR_CHARTMUSEUM_PASSWORD", ""), "ChartMuseum basic auth password")
+	flagSet.StringVar(&f.chartMuseumToken, "chartmuseum-token", getStringEnv("HCR_CHARTMUSEUM_TOKEN", ""), "ChartMuseum bearer token, takes precedence over username and password")
+	flagSet.BoolVar(&f.chartMuseumOnly, "chartmuseum-only", getBoolEnv("HCR_CHARTMUSEUM_ONLY", orBool(f.file.ChartMuseum.Only, false)), "Whether to upload charts to ChartMuseum only, without GitHub releases and GitHub pages index")
+}
+
+// s3Flags are flags for commands that work with index in S3-compatible bucket instead of GitHub pages
+func s3Flags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.StringVar(&f.s3Url, "s3-url", getStringEnv("HCR_S3_URL", f.file.S3.Url), "S3 bucket and prefix charts and index are uploaded to instead of GitHub releases and GitHub pages e.g. s3://bucket/charts")
+	flagSet.StringVar(&f.s3Endpoint, "s3-endpoint", getStringEnv("HCR_S3_ENDPOINT", f.file.S3.Endpoint), "S3 endpoint e.g. http://localhost:9000 for MinIO, defaults to AWS S3 regional endpoint")
+	flagSet.StringVar(&f.s3Region, "s3-region", getStringEnv("HCR_S3_REGION", getStringEnv("AWS_REGION", orString(f.file.S3.Region, s3.DefaultRegion))), "S3 region")
+	flagSet.StringVar(&f.s3AccessKey, "s3-access-key", getStringEnv("HCR_S3_ACCESS_KEY", getStringEnv("AWS_ACCESS_KEY_ID", "")), "S3 access key, requests are anonymous if it is not set")
+	flagSet.StringVar(&f.s3SecretKey, "s3-secret-key", getStringEnv("HCR_S3_SECRET_KEY", getStringEnv("AWS_SECRET_ACCESS_KEY", "")), "S3 secret key")
+	flagSet.BoolVar(&f.s3PathStyle, "s3-path-style", getBoolEnv("HCR_S3_PATH_STYLE", orBool(f.file.S3.PathStyle, false)), "Whether to use path-style S3 urls (MinIO) instead of virtual-hosted urls")
+	flagSet.StringVar(&f.s3PublicUrl, "s3-public-url", getStringEnv("HCR_S3_PUBLIC_URL", f.file.S3.PublicUrl), "Url the S3 bucket prefix is served on, used for chart urls in the index, urls are relative to the index if it is not set")
+}
+
+// retentionFlags are flags for commands that update GitHub pages index
+func retentionFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.IntVar(&f.keepLast, "retention-keep-last", getIntEnv("HCR_RETENTION_KEEP_LAST", orInt(f.file.Retention.KeepLast, 0)), "Number of the latest versions per chart kept in the index, 0 keeps all the versions")
+	flagSet.StringVar(&f.keepLatestPer, "retention-keep-latest-per", getStringEnv("HCR_RETENTION_KEEP_LATEST_PER", f.file.Retention.KeepLatestPer), fmt.Sprintf("Keep the latest version of every %s version in the index as well", strings.Join(helm.KeepLatestPer, " or ")))
+	flagSet.DurationVar(&f.preReleaseMaxAge, "retention-pre-release-max-age", getDurationEnv("HCR_RETENTION_PRE_RELEASE_MAX_AGE", f.file.preReleaseMaxAge()), "Remove pre-release versions older than max age from the index, 0 keeps all the pre-release versions")
+	flagSet.BoolVar(&f.deleteReleases, "retention-delete-releases", getBoolEnv("HCR_RETENTION_DELETE_RELEASES", orBool(f.file.Retention.DeleteReleases, false)), "Whether to delete GitHub release assets of versions removed from the index as well")
+}
+
+// verifyFlags are flags for verify command
+func verifyFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.StringVar(&f.helmKeyring, "helm-keyring", getStringEnv("HCR_HELM_KEYRING", f.file.HelmKeyring), "Location of a public keyring, if it is set, provenance files are verified as well")
+}
+
+func concurrencyFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.IntVar(&f.concurrency, "concurrency", getIntEnv("HCR_CONCURRENCY", orInt(f.file.Concurrency, 1)), "Number of charts packaged and released at the same time")
+}
+
+func versionFlags(flagSet *flag.FlagSet, f *flags) {
+	flagSet.BoolVar(&f.version, "version", getBoolEnv("HCR_VERSION", false), "Print hcr version")
+}
+
+// validate validates flags, flags that are not registered for the command are not validated
+func (f flags) validate(flagSet *flag.FlagSet) error {
+	registered := func(name string) bool { return flagSet.Lookup(name) != nil }
+
+	if registered("pages-branch") && f.pagesBranch == "" {
 		return errors.New("pages-branch cannot be empty")
 	}
-	if f.chartsDir == "" {
+	if registered("charts-dir") && f.chartsDir == "" {
 		return errors.New("charts-dir cannot be empty")
 	}
-	if f.remote == "" {
+	if registered("remote") && f.remote == "" {
 		return errors.New("remote cannot be empty")
 	}
+	if registered("backend") && !slices.Contains(forge.Backends, f.backend) {
+		return fmt.Errorf("backend %q is not valid, expected one of %s", f.backend, strings.Join(forge.Backends, ", "))
+	}
+	if registered("retries") && f.retries < 0 {
+		return errors.New("retries cannot be negative")
+	}
+	if registered("concurrency") && f.concurrency < 1 {
+		return errors.New("concurrency has to be greater than 0")
+	}
+	if registered("tag") {
+		if err := hcr.ValidateTagTemplate(f.tag); err != nil {
+			return fmt.Errorf("tag: %w", err)
+		}
+	}
+	if registered("retention-keep-last") && f.keepLast < 0 {
+		return errors.New("retention-keep-last cannot be negative")
+	}
+	if registered("retention-keep-latest-per") && f.keepLatestPer != "" && !slices.Contains(helm.KeepLatestPer, f.keepLatestPer) {
+		return fmt.Errorf("retention-keep-latest-per %q is not valid, expected one of %s", f.keepLatestPer, strings.Join(helm.KeepLatestPer, ", "))
+	}
+	// latest per major (minor) version is kept in addition to the last versions, on its own it would keep all the versions
+	if registered("retention-keep-latest-per") && f.keepLatestPer != "" && f.keepLast == 0 {
+		return errors.New("retention-keep-latest-per requires retention-keep-last")
+	}
+	if registered("page-template") && f.pageTemplate != "" {
+		if _, err := os.Stat(f.pageTemplate); err != nil {
+			return fmt.Errorf("page-template: %w", err)
+		}
+	}
+	if registered("report-format") && !slices.Contains(hcr.ReportFormats, f.reportFormat) {
+		return fmt.Errorf("report-format %q is not valid, expected one of %s", f.reportFormat, strings.Join(hcr.ReportFormats, ", "))
+	}
+	if registered("oci-registry") && f.ociRegistry != "" && !strings.HasPrefix(f.ociRegistry, oci.Scheme) {
+		return fmt.Errorf("oci-registry %q has to start with %s", f.ociRegistry, oci.Scheme)
+	}
+	if registered("oci-only") && f.ociOnly && f.ociRegistry == "" {
+		return errors.New("oci-only requires oci-registry")
+	}
+	if registered("chartmuseum-url") && f.chartMuseumUrl != "" && !strings.HasPrefix(f.chartMuseumUrl, "http://") && !strings.HasPrefix(f.chartMuseumUrl, "https://") {
+		return errors.New("chartmuseum-url has to start with http:// or https://")
+	}
+	if registered("chartmuseum-only") && f.chartMuseumOnly {
+		if f.chartMuseumUrl == "" {
+			return errors.New("chartmuseum-only requires chartmuseum-url")
+		}
+		if f.ociOnly {
+			return errors.New("chartmuseum-only cannot be used with oci-only")
+		}
+		if f.s3Url != "" {
+			return errors.New("chartmuseum-only cannot be used with s3-url")
+		}
+	}
+	if registered("s3-url") && f.s3Url != "" {
+		if _, _, err := (s3.Config{Url: f.s3Url}).BucketAndPrefix(); err != nil {
+			return fmt.Errorf("s3-url: %w", err)
+		}
+		if registered("oci-only") && f.ociOnly {
+			return errors.New("oci-only cannot be used with s3-url")
+		}
+	}
+	if registered("out") && f.exportOut == "" {
+		return errors.New("out cannot be empty")
+	}
+	// export does not use git, charts sources do not have to be in git repository
+	if registered("out") && f.reproducible && getStringEnv("SOURCE_DATE_EPOCH", "") == "" {
+		return errors.New("export with reproducible requires SOURCE_DATE_EPOCH, chart last commit time is not used")
+	}
+	if registered("out") && f.artifactHubChanges {
+		return errors.New("artifacthub-changes cannot be used with export, annotation is generated from git history")
+	}
+	if registered("helm-dependency") && !slices.Contains(helm.DependencyModes, f.helmDependency) {
+		return fmt.Errorf("helm-dependency %q is not valid, expected one of %s", f.helmDependency, strings.Join(helm.DependencyModes, ", "))
+	}
 	return nil
 }
 
+// sourceDateEpoch returns time set by SOURCE_DATE_EPOCH env. variable (unix timestamp) in reproducible mode, zero time
+// is returned if the variable is not set
+func (f flags) sourceDateEpoch() (time.Time, error) {
+	epoch := getStringEnv("SOURCE_DATE_EPOCH", "")
+	if !f.reproducible || epoch == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH %q is not valid unix timestamp", epoch)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// yankConfig returns yank command config from the command arguments (chart and version)
+func (f flags) yankConfig(args []string) (hcr.YankConfig, error) {
+	yank := hcr.YankConfig{Deprecate: f.yankDeprecate, PreRelease: f.yankPreRelease, Notice: f.yankNotice}
+	switch {
+	case len(args) == 2:
+		yank.Chart, yank.Version = args[0], args[1]
+	case len(args) == 1 && f.yankDeprecate:
+		yank.Chart = args[0]
+	default:
+		return hcr.YankConfig{}, errors.New("yank command expects chart and version arguments (version is optional with -deprecate)")
+	}
+	if yank.Version == "" && (yank.PreRelease || yank.Notice != "") {
+		return hcr.YankConfig{}, errors.New("mark-pre-release and notice require chart version argument")
+	}
+	return yank, nil
+}
+
 func getStringEnv(envName string, defaultValue string) string {
 	env, ok := os.LookupEnv(envName)
 	if !ok {
@@ -101,3 +491,27 @@ func getBoolEnv(envName string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getIntEnv(envName string, defaultValue int) int {
+	env, ok := os.LookupEnv(envName)
+	if !ok {
+		return defaultValue
+	}
+
+	if v, err := strconv.Atoi(env); err == nil {
+		return v
+	}
+	return defaultValue
+}
+
+func getDurationEnv(envName string, defaultValue time.Duration) time.Duration {
+	env, ok := os.LookupEnv(envName)
+	if !ok {
+		return defaultValue
+	}
+
+	if v, err := time.ParseDuration(env); err == nil {
+		return v
+	}
+	return defaultValue
+}
@@ -0,0 +1,52 @@
+package forge
+
+import (
+	"context"
+	"strings"
+)
+
+// backends charts are released to, Auto detects backend from the remote url host
+const (
+	Auto   = "auto"
+	GitHub = "github"
+	GitLab = "gitlab"
+	// Gitea is Gitea or Forgejo (e.g. Codeberg)
+	Gitea = "gitea"
+)
+
+var Backends = []string{Auto, GitHub, GitLab, Gitea}
+
+// giteaHosts are host substrings of Gitea and Forgejo instances
+var giteaHosts = []string{"gitea", "forgejo", "codeberg"}
+
+// Client creates releases with chart assets on the git hosting service
+type Client interface {
+	// CreateRelease creates release (if it doesn't exist) and returns release id
+	CreateRelease(ctx context.Context, release Release, dryRun bool) (int64, error)
+	// UploadAsset upload asset (and provenance file if it is set) and return uploaded asset with its release
+	UploadAsset(ctx context.Context, releaseId int64, release Release) (UploadedAsset, error)
+	// ListReleaseAssets returns assets of all the repository releases
+	ListReleaseAssets(ctx context.Context, owner, repo string) ([]ReleaseAsset, error)
+	// DownloadAsset downloads release asset to the path
+	DownloadAsset(ctx context.Context, owner, repo string, asset ReleaseAsset, path string) error
+	// DeleteReleaseAssets deletes assets from the release, release is deleted as well if it has no assets left
+	DeleteReleaseAssets(ctx context.Context, owner, repo, tag string, assetNames []string) error
+	// YankRelease marks release as pre-release (if supported) and prepends notice to the release description
+	YankRelease(ctx context.Context, owner, repo, tag string, preRelease bool, notice string) error
+	// PagesUrl returns default pages url of the repository
+	PagesUrl(owner, repo string) (string, error)
+}
+
+// DetectBackend returns backend of the remote host, GitHub is returned if the host is not recognized
+func DetectBackend(host string) string {
+	host = strings.ToLower(host)
+	if strings.Contains(host, GitLab) {
+		return GitLab
+	}
+	for _, giteaHost := range giteaHosts {
+		if strings.Contains(host, giteaHost) {
+			return Gitea
+		}
+	}
+	return GitHub
+}
@@ -0,0 +1,40 @@
+package forge
+
+import "time"
+
+type Release struct {
+	Owner string
+	Repo  string
+	Tag   string
+
+	Name string
+	// ChartName and ChartVersion identify the released chart (GitLab package name and version)
+	ChartName      string
+	ChartVersion   string
+	Description    string
+	AssetPath      string
+	ProvenancePath string
+	// ExtraAssets are paths of files uploaded to the release together with the chart, asset name is file name
+	ExtraAssets []string
+	PreRelease  bool
+	// Force replaces existing release assets
+	Force bool
+}
+
+// UploadedAsset is chart asset uploaded to the release
+type UploadedAsset struct {
+	ReleaseId  int64
+	ReleaseUrl string
+	AssetUrl   string
+}
+
+// ReleaseAsset is asset of the existing release
+type ReleaseAsset struct {
+	Id         int64
+	Name       string
+	Url        string
+	CreatedAt  time.Time
+	ReleaseId  int64
+	ReleaseTag string
+	ReleaseUrl string
+}
@@ -3,12 +3,21 @@ package git
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"net/url"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// ErrPushRejected is returned when the push is rejected because the remote branch contains commits that are not
+// present locally (someone else pushed in between)
+var ErrPushRejected = errors.New("push rejected, remote branch contains commits that are not present locally")
+
 type Client struct {
 	log *zap.Logger
 }
@@ -47,8 +56,9 @@ func (c Client) RemoveWorktree(path string) error {
 	return c.cmdRun("", exec.Command("git", "worktree", "remove", path, "--force"), false)
 }
 
-func (c Client) AddAndCommit(workingDir, file, message string) error {
-	if err := c.cmdRun(workingDir, exec.Command("git", "add", file), false); err != nil {
+// AddAndCommit adds files and commits them in a single commit
+func (c Client) AddAndCommit(workingDir, message string, files ...string) error {
+	if err := c.cmdRun(workingDir, exec.Command("git", append([]string{"add"}, files...)...), false); err != nil {
 		return err
 	}
 	return c.cmdRun(workingDir, exec.Command("git", "commit", "-m", fmt.Sprintf("%q", message)), false)
@@ -62,15 +72,167 @@ func (c Client) Push(workingDir, remote, branch, token string) error {
 
 	// run silently, so we don't log token (if it has been supplied)
 	fullBranch := fmt.Sprintf("HEAD:refs/heads/%s", branch)
-	return c.cmdRun(workingDir, exec.Command("git", "push", pushUrl, fullBranch), true)
+	if err := c.cmdRun(workingDir, exec.Command("git", "push", pushUrl, fullBranch), true); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && isPushRejected(string(exitErr.Stderr)) {
+			return ErrPushRejected
+		}
+		return err
+	}
+	return nil
 }
 
-func (c Client) GetOwnerAndRepo(workingDir, remote string) (string, string, error) {
+// FetchAndReset fetches remote branch and resets working dir to it, all local changes and commits are discarded
+func (c Client) FetchAndReset(workingDir, remote, branch string) error {
+	if err := c.cmdRun(workingDir, exec.Command("git", "fetch", remote, branch), false); err != nil {
+		return err
+	}
+	return c.cmdRun(workingDir, exec.Command("git", "reset", "--hard", fmt.Sprintf("%s/%s", remote, branch)), false)
+}
+
+// ChangedFiles returns absolute paths of files changed between since ref and HEAD in the repository of the working dir
+func (c Client) ChangedFiles(workingDir, since string) ([]string, error) {
+	top, err := c.cmdOutput(workingDir, exec.Command("git", "rev-parse", "--show-toplevel"), false)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.cmdOutput(workingDir, exec.Command("git", "diff", "--name-only", since, "HEAD"), false)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		if file := strings.TrimSpace(sc.Text()); file != "" {
+			files = append(files, filepath.Join(strings.TrimSpace(string(top)), filepath.FromSlash(file)))
+		}
+	}
+	return files, nil
+}
+
+type Commit struct {
+	Hash    string
+	Subject string
+}
+
+// Log returns (non-merge) commits that changed files in the path, from since ref (exclusive) to HEAD, newest first.
+// If since is empty, the whole history of the path is returned
+func (c Client) Log(path, since string) ([]Commit, error) {
+	revision := "HEAD"
+	if since != "" {
+		revision = fmt.Sprintf("%s..HEAD", since)
+	}
+	b, err := c.cmdOutput("", exec.Command("git", "log", "--no-merges", "--format=%h%x09%s", revision, "--", path), false)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		hash, subject, ok := strings.Cut(sc.Text(), "\t")
+		if !ok {
+			continue
+		}
+		commits = append(commits, Commit{Hash: hash, Subject: strings.TrimSpace(subject)})
+	}
+	return commits, nil
+}
+
+// CommitTime returns committer time of the last commit that changed the path, or of the HEAD commit if the path is empty
+func (c Client) CommitTime(path string) (time.Time, error) {
+	args := []string{"log", "-1", "--format=%ct", "HEAD"}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+	b, err := c.cmdOutput("", exec.Command("git", args...), false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	out := strings.TrimSpace(string(b))
+	if out == "" {
+		return time.Time{}, fmt.Errorf("no commit found for %q path", path)
+	}
+	seconds, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse commit time %q: %w", out, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// Describe returns the most recent tag reachable from the ref
+func (c Client) Describe(ref string) (string, error) {
+	b, err := c.cmdOutput("", exec.Command("git", "describe", "--tags", "--abbrev=0", ref), false)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// IsShallow returns true if the current repository is shallow clone (history is not available)
+func (c Client) IsShallow() (bool, error) {
+	b, err := c.cmdOutput("", exec.Command("git", "rev-parse", "--is-shallow-repository"), false)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(b)) == "true", nil
+}
+
+// RemoteUrl is parsed git remote url, Owner is the whole path without the repository name, so it can contain nested
+// groups (GitLab)
+type RemoteUrl struct {
+	Url string
+	// Scheme is http, https or ssh (scp-like syntax as well)
+	Scheme string
+	// Host can contain port
+	Host  string
+	Owner string
+	Repo  string
+}
+
+// Hostname returns host without port
+func (r RemoteUrl) Hostname() string {
+	return (&url.URL{Host: r.Host}).Hostname()
+}
+
+// WebUrl returns https (or http if the remote is http) url of the host, ssh port is not used
+func (r RemoteUrl) WebUrl() string {
+	switch r.Scheme {
+	case "http":
+		return "http://" + r.Host
+	case "ssh":
+		return "https://" + r.Hostname()
+	default:
+		return "https://" + r.Host
+	}
+}
+
+// PushUrl returns web url of the repository with the token, token user is x-access-token for GitHub and oauth2 for
+// other hosts
+func (r RemoteUrl) PushUrl(token string) string {
+	scheme, host, _ := strings.Cut(r.WebUrl(), "://")
+	user := "oauth2"
+	if r.Hostname() == "github.com" {
+		user = "x-access-token"
+	}
+	return fmt.Sprintf("%s://%s:%s@%s/%s/%s.git", scheme, user, token, host, r.Owner, r.Repo)
+}
+
+func (c Client) GetRemoteUrl(workingDir, remote string) (RemoteUrl, error) {
 	b, err := c.cmdOutput(workingDir, exec.Command("git", "remote", "get-url", "--push", remote), false)
+	if err != nil {
+		return RemoteUrl{}, err
+	}
+	return ParseRemoteUrl(strings.TrimSpace(string(b)))
+}
+
+func (c Client) GetOwnerAndRepo(workingDir, remote string) (string, string, error) {
+	remoteUrl, err := c.GetRemoteUrl(workingDir, remote)
 	if err != nil {
 		return "", "", err
 	}
-	return getOwnerAndRepoFromUrl(strings.TrimSpace(string(b)))
+	return remoteUrl.Owner, remoteUrl.Repo, nil
 }
 
 func (c Client) getPushUrl(workingDir, remote, token string) (string, error) {
@@ -85,24 +247,51 @@ func (c Client) getPushUrl(workingDir, remote, token string) (string, error) {
 		return remoteUrl, nil
 	}
 
-	owner, repo, err := getOwnerAndRepoFromUrl(remoteUrl)
+	parsed, err := ParseRemoteUrl(remoteUrl)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("https://x-access-token:%s@github.com/%s/%s.git", token, owner, repo), nil
+	return parsed.PushUrl(token), nil
 }
 
-func getOwnerAndRepoFromUrl(remoteUrl string) (string, string, error) {
-	// this can be either git@github.com:<org>/<repo>.git or https://github.com/<org>/<repo>.git
-	columnParts := strings.Split(remoteUrl, ":")
-	if len(columnParts) != 2 {
-		return "", "", fmt.Errorf("invalid remote url %s, no : found", remoteUrl)
+func isPushRejected(stderr string) bool {
+	return strings.Contains(stderr, "[rejected]") || strings.Contains(stderr, "non-fast-forward") ||
+		strings.Contains(stderr, "fetch first")
+}
+
+// ParseRemoteUrl parses remote url, it can be either scp-like git@github.com:<org>/<repo>.git or url e.g.
+// https://github.com/<org>/<repo>.git, ssh://git@gitlab.example.com:2222/<group>/<subgroup>/<repo>.git
+func ParseRemoteUrl(remoteUrl string) (RemoteUrl, error) {
+	result := RemoteUrl{Url: remoteUrl}
+	var urlPath string
+	if strings.Contains(remoteUrl, "://") {
+		u, err := url.Parse(remoteUrl)
+		if err != nil {
+			return RemoteUrl{}, fmt.Errorf("invalid remote url %s: %w", remoteUrl, err)
+		}
+		result.Scheme, result.Host, urlPath = u.Scheme, u.Host, u.Path
+	} else {
+		userAndHost, p, ok := strings.Cut(remoteUrl, ":")
+		if !ok {
+			return RemoteUrl{}, fmt.Errorf("invalid remote url %s, no : found", remoteUrl)
+		}
+		_, host, _ := strings.Cut(userAndHost, "@")
+		if host == "" {
+			host = userAndHost
+		}
+		result.Scheme, result.Host, urlPath = "ssh", host, p
 	}
-	pathParts := strings.Split(columnParts[1], "/")
+	if result.Host == "" {
+		return RemoteUrl{}, fmt.Errorf("invalid remote url %s, no host found", remoteUrl)
+	}
+
+	pathParts := strings.Split(strings.Trim(urlPath, "/"), "/")
 	if len(pathParts) < 2 {
-		return "", "", fmt.Errorf("invalid remote url %s, min 2 path parts expected", remoteUrl)
+		return RemoteUrl{}, fmt.Errorf("invalid remote url %s, min 2 path parts expected", remoteUrl)
 	}
-	return pathParts[len(pathParts)-2], strings.TrimSuffix(pathParts[len(pathParts)-1], ".git"), nil
+	result.Owner = strings.Join(pathParts[:len(pathParts)-1], "/")
+	result.Repo = strings.TrimSuffix(pathParts[len(pathParts)-1], ".git")
+	return result, nil
 }
 
 // cmdRun runs specified command in the working dir, input and output is logged
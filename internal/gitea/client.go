@@ -0,0 +1,503 @@
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	httpTimeout = 5 * time.Second
+	// uploadTimeout is timeout of the release asset upload and download
+	uploadTimeout = 5 * time.Minute
+	// pageLimit is number of releases listed per page, Gitea caps it by MAX_RESPONSE_ITEMS (50 by default)
+	pageLimit = 50
+)
+
+// Client is Gitea (and Forgejo) REST API (v1) client, release and asset API mirrors the GitHub one
+type Client struct {
+	apiUrl      string
+	token       string
+	httpClient  *http.Client
+	retryConfig utils.Retry
+	log         *zap.Logger
+}
+
+// NewClient returns Gitea client for the api url e.g. https://codeberg.org/api/v1, token is sent in Authorization
+// header if it is not empty. Failed API calls are retried according to the retry config.
+func NewClient(log *zap.Logger, token, apiUrl string, retryConfig utils.Retry) (Client, error) {
+	u, err := url.Parse(apiUrl)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return Client{}, fmt.Errorf("invalid gitea api url %q", apiUrl)
+	}
+	return Client{
+		apiUrl:      strings.TrimSuffix(apiUrl, "/"),
+		token:       token,
+		httpClient:  &http.Client{Timeout: uploadTimeout},
+		retryConfig: retryConfig,
+		log:         log,
+	}, nil
+}
+
+// DefaultApiUrl returns Gitea api url of the instance web url e.g. https://codeberg.org
+func DefaultApiUrl(webUrl string) string {
+	return strings.TrimSuffix(webUrl, "/") + "/api/v1"
+}
+
+type releaseResponse struct {
+	Id         int64           `json:"id"`
+	TagName    string          `json:"tag_name"`
+	Name       string          `json:"name"`
+	Body       string          `json:"body"`
+	PreRelease bool            `json:"prerelease"`
+	HtmlUrl    string          `json:"html_url"`
+	Assets     []assetResponse `json:"assets"`
+}
+
+type assetResponse struct {
+	Id                 int64     `json:"id"`
+	Name               string    `json:"name"`
+	CreatedAt          time.Time `json:"created_at"`
+	BrowserDownloadUrl string    `json:"browser_download_url"`
+}
+
+// apiError is non-2xx Gitea API response
+type apiError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// CreateRelease creates release (if it doesn't exist) and returns release id, tag is created from the repository
+// default branch if it does not exist
+func (c Client) CreateRelease(ctx context.Context, release forge.Release, dryRun bool) (int64, error) {
+	existingRelease, err := c.getReleaseByTag(ctx, release.Owner, release.Repo, release.Tag)
+	if err == nil {
+		c.log.Info(fmt.Sprintf("%s release %s already exists, skipping create release", release.Name, release.Tag))
+		return existingRelease.Id, nil
+	}
+	if !isNotFound(err) {
+		return 0, fmt.Errorf("get release by %s tag: %w", release.Tag, err)
+	}
+	if dryRun {
+		c.log.Info(fmt.Sprintf("%s create release %s skipping, dry run is set to true", release.Name, release.Tag))
+		return 0, nil
+	}
+
+	request := map[string]any{
+		"name":       release.Name,
+		"body":       release.Description,
+		"tag_name":   release.Tag,
+		"prerelease": release.PreRelease,
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, err
+	}
+	releasesUrl := c.apiUrl + repoPath(release.Owner, release.Repo) + "/releases"
+	tagUrl := fmt.Sprintf("%s/tags/%s", releasesUrl, url.PathEscape(release.Tag))
+	var response releaseResponse
+	var attempt int
+	err = c.retry(ctx, fmt.Sprintf("%s create release %s", release.Name, release.Tag), func() error {
+		attempt++
+		// create is not idempotent, previous attempt could have created the release and only the response was lost
+		if attempt > 1 {
+			_, err := c.request(ctx, http.MethodGet, tagUrl, nil, "", &response)
+			if err == nil {
+				c.log.Info(fmt.Sprintf("%s release %s created by previous attempt, reusing it", release.Name, release.Tag))
+				return nil
+			}
+			if !isNotFound(err) {
+				return err
+			}
+		}
+		_, err := c.request(ctx, http.MethodPost, releasesUrl, bytes.NewReader(body), "application/json", &response)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s create release %s: %w", release.Name, release.Tag, err)
+	}
+	c.log.Info(fmt.Sprintf("%s release %s with id %d created", release.Name, release.Tag, response.Id))
+	return response.Id, nil
+}
+
+// UploadAsset upload asset (and provenance file if it is set) and return uploaded asset with its release
+func (c Client) UploadAsset(ctx context.Context, releaseId int64, release forge.Release) (forge.UploadedAsset, error) {
+	var existingRelease releaseResponse
+	releasePath := fmt.Sprintf("%s/releases/%d", repoPath(release.Owner, release.Repo), releaseId)
+	if err := c.do(ctx, http.MethodGet, releasePath, nil, &existingRelease); err != nil {
+		return forge.UploadedAsset{}, fmt.Errorf("get release by %d id: %w", releaseId, err)
+	}
+
+	assetUrl, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, release.AssetPath)
+	if err != nil {
+		return forge.UploadedAsset{}, err
+	}
+	// helm looks for provenance file at the chart url with .prov suffix, asset is uploaded to the same release
+	if release.ProvenancePath != "" {
+		if _, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, release.ProvenancePath); err != nil {
+			return forge.UploadedAsset{}, fmt.Errorf("upload provenance file: %w", err)
+		}
+	}
+	for _, extraAsset := range release.ExtraAssets {
+		if _, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, extraAsset); err != nil {
+			return forge.UploadedAsset{}, fmt.Errorf("upload extra asset: %w", err)
+		}
+	}
+	return forge.UploadedAsset{ReleaseId: existingRelease.Id, ReleaseUrl: existingRelease.HtmlUrl, AssetUrl: assetUrl}, nil
+}
+
+// uploadAssetIfNotExists uploads asset if it does not exist in the release, if the release force is set, existing
+// asset is deleted and uploaded again
+func (c Client) uploadAssetIfNotExists(ctx context.Context, existingRelease releaseResponse, release forge.Release, assetPath string) (string, error) {
+	assetName := filepath.Base(assetPath)
+	assetsPath := fmt.Sprintf("%s/releases/%d/assets", repoPath(release.Owner, release.Repo), existingRelease.Id)
+	for _, asset := range existingRelease.Assets {
+		if asset.Name != assetName {
+			continue
+		}
+		if !release.Force {
+			c.log.Info(fmt.Sprintf("%s release %s asset %s already exists, skipping create asset", release.Name, release.Tag, asset.BrowserDownloadUrl))
+			return asset.BrowserDownloadUrl, nil
+		}
+		c.log.Warn(fmt.Sprintf("%s release %s asset %s already exists, force is set, replacing asset", release.Name, release.Tag, asset.BrowserDownloadUrl))
+		if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/%d", assetsPath, asset.Id), nil, nil); err != nil {
+			return "", fmt.Errorf("%s release %s delete asset %s: %w", release.Name, release.Tag, assetName, err)
+		}
+	}
+
+	var asset assetResponse
+	var attempt int
+	err := c.retry(ctx, fmt.Sprintf("%s release %s upload asset %s", release.Name, release.Tag, assetPath), func() error {
+		attempt++
+		// upload is not idempotent, previous attempt could have uploaded the asset and only the response was lost
+		if attempt > 1 {
+			existing, ok, err := c.findAsset(ctx, release, existingRelease.Id, assetName)
+			if err != nil {
+				return err
+			}
+			if ok {
+				c.log.Info(fmt.Sprintf("%s release %s asset %s uploaded by previous attempt, reusing it", release.Name, release.Tag, assetName))
+				asset = existing
+				return nil
+			}
+		}
+		body, contentType, err := multipartFile(assetPath, assetName)
+		if err != nil {
+			return err
+		}
+		u := fmt.Sprintf("%s%s?name=%s", c.apiUrl, assetsPath, url.QueryEscape(assetName))
+		_, err = c.request(ctx, http.MethodPost, u, body, contentType, &asset)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s release %s upload asset %s: %w", release.Name, release.Tag, assetName, err)
+	}
+	return asset.BrowserDownloadUrl, nil
+}
+
+// findAsset returns release asset with the name, false is returned if the release does not have it
+func (c Client) findAsset(ctx context.Context, release forge.Release, releaseId int64, assetName string) (assetResponse, bool, error) {
+	var existingRelease releaseResponse
+	u := fmt.Sprintf("%s%s/releases/%d", c.apiUrl, repoPath(release.Owner, release.Repo), releaseId)
+	if _, err := c.request(ctx, http.MethodGet, u, nil, "", &existingRelease); err != nil {
+		return assetResponse{}, false, err
+	}
+	for _, asset := range existingRelease.Assets {
+		if asset.Name == assetName {
+			return asset, true, nil
+		}
+	}
+	return assetResponse{}, false, nil
+}
+
+// multipartFile returns multipart form body with the file as attachment field
+func multipartFile(path, name string) (io.Reader, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("attachment", name)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(b); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, w.FormDataContentType(), nil
+}
+
+// ListReleaseAssets returns assets of all the repository releases, releases are listed page by page
+func (c Client) ListReleaseAssets(ctx context.Context, owner, repo string) ([]forge.ReleaseAsset, error) {
+	var assets []forge.ReleaseAsset
+	for page := 1; ; page++ {
+		var releases []releaseResponse
+		path := fmt.Sprintf("%s/releases?limit=%d&page=%d", repoPath(owner, repo), pageLimit, page)
+		if err := c.do(ctx, http.MethodGet, path, nil, &releases); err != nil {
+			return nil, fmt.Errorf("list releases: %w", err)
+		}
+		if len(releases) == 0 {
+			c.log.Info(fmt.Sprintf("listed %d release assets", len(assets)))
+			return assets, nil
+		}
+
+		for _, release := range releases {
+			for _, asset := range release.Assets {
+				assets = append(assets, forge.ReleaseAsset{
+					Id:         asset.Id,
+					Name:       asset.Name,
+					Url:        asset.BrowserDownloadUrl,
+					CreatedAt:  asset.CreatedAt,
+					ReleaseId:  release.Id,
+					ReleaseTag: release.TagName,
+					ReleaseUrl: release.HtmlUrl,
+				})
+			}
+		}
+	}
+}
+
+// DownloadAsset downloads release asset to the path, token is sent only if the asset is hosted on the Gitea instance
+func (c Client) DownloadAsset(ctx context.Context, _, _ string, asset forge.ReleaseAsset, path string) error {
+	return c.retry(ctx, fmt.Sprintf("download %s release asset %s", asset.ReleaseTag, asset.Name), func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.Url, nil)
+		if err != nil {
+			return err
+		}
+		if c.isInstanceUrl(asset.Url) {
+			c.setToken(req)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := checkResponse(req, resp); err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, resp.Body)
+		return err
+	})
+}
+
+// DeleteReleaseAssets deletes assets from the release, release is deleted as well if it has no assets left. Release
+// can contain assets of other charts (if the tag does not contain chart name), so only supplied assets are deleted.
+func (c Client) DeleteReleaseAssets(ctx context.Context, owner, repo, tag string, assetNames []string) error {
+	release, err := c.getReleaseByTag(ctx, owner, repo, tag)
+	if err != nil {
+		if isNotFound(err) {
+			c.log.Info(fmt.Sprintf("release %s does not exist, skipping delete", tag))
+			return nil
+		}
+		return fmt.Errorf("get release by %s tag: %w", tag, err)
+	}
+
+	releasePath := fmt.Sprintf("%s/releases/%d", repoPath(owner, repo), release.Id)
+	var remaining int
+	for _, asset := range release.Assets {
+		if !slices.Contains(assetNames, asset.Name) {
+			remaining++
+			continue
+		}
+		if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/assets/%d", releasePath, asset.Id), nil, nil); err != nil {
+			return fmt.Errorf("release %s delete asset %s: %w", tag, asset.Name, err)
+		}
+		c.log.Info(fmt.Sprintf("release %s asset %s deleted", tag, asset.Name))
+	}
+	if remaining > 0 {
+		c.log.Info(fmt.Sprintf("release %s has %d other assets, skipping delete release", tag, remaining))
+		return nil
+	}
+
+	if err := c.do(ctx, http.MethodDelete, releasePath, nil, nil); err != nil {
+		return fmt.Errorf("delete release %s: %w", tag, err)
+	}
+	c.log.Info(fmt.Sprintf("release %s deleted", tag))
+	return nil
+}
+
+// YankRelease marks release as pre-release (if preRelease is set) and prepends notice to the release body (if notice
+// is not empty and the body does not start with it already)
+func (c Client) YankRelease(ctx context.Context, owner, repo, tag string, preRelease bool, notice string) error {
+	release, err := c.getReleaseByTag(ctx, owner, repo, tag)
+	if err != nil {
+		return fmt.Errorf("get release by %s tag: %w", tag, err)
+	}
+
+	update := make(map[string]any)
+	if preRelease && !release.PreRelease {
+		update["prerelease"] = true
+	}
+	if notice != "" && !strings.HasPrefix(release.Body, notice) {
+		update["body"] = fmt.Sprintf("%s\n\n%s", notice, release.Body)
+	}
+	if len(update) == 0 {
+		c.log.Info(fmt.Sprintf("release %s is already yanked, skipping edit release", tag))
+		return nil
+	}
+
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("%s/releases/%d", repoPath(owner, repo), release.Id), update, nil); err != nil {
+		return fmt.Errorf("edit release %s: %w", tag, err)
+	}
+	c.log.Info(fmt.Sprintf("release %s yanked", tag))
+	return nil
+}
+
+// PagesUrl returns Codeberg pages url https://<owner>.codeberg.page/<repo>, other instances do not have pages
+func (c Client) PagesUrl(owner, repo string) (string, error) {
+	u, _ := url.Parse(c.apiUrl)
+	if u.Hostname() != "codeberg.org" {
+		return "", fmt.Errorf("pages url of gitea %s cannot be derived, pages url has to be set", u.Host)
+	}
+	return fmt.Sprintf("https://%s.codeberg.page/%s", owner, repo), nil
+}
+
+func (c Client) getReleaseByTag(ctx context.Context, owner, repo, tag string) (releaseResponse, error) {
+	var release releaseResponse
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/releases/tags/%s", repoPath(owner, repo), url.PathEscape(tag)), nil, &release)
+	return release, err
+}
+
+// do sends json request (if in is not nil) to the api path and decodes json response to out (if it is not nil),
+// transient errors are retried
+func (c Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	return c.retry(ctx, fmt.Sprintf("%s %s", method, path), func() error {
+		var r io.Reader
+		var contentType string
+		if body != nil {
+			r, contentType = bytes.NewReader(body), "application/json"
+		}
+		_, err := c.request(ctx, method, c.apiUrl+path, r, contentType, out)
+		return err
+	})
+}
+
+// request sends request with the token and returns response header, json response is decoded to out if it is not nil
+func (c Client) request(ctx context.Context, method, u string, body io.Reader, contentType string, out any) (http.Header, error) {
+	timeout := httpTimeout
+	if strings.HasPrefix(contentType, "multipart/") {
+		timeout = uploadTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.setToken(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(req, resp); err != nil {
+		return nil, err
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("decode %s %s response: %w", method, req.URL.Path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+func (c Client) setToken(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+}
+
+func (c Client) isInstanceUrl(u string) bool {
+	api, _ := url.Parse(c.apiUrl)
+	asset, err := url.Parse(u)
+	return err == nil && asset.Host == api.Host
+}
+
+// checkResponse returns api error if the response status is not 2xx, message is taken from the json response body
+func checkResponse(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var body struct {
+		Message string `json:"message"`
+	}
+	message := strings.TrimSpace(string(b))
+	if json.Unmarshal(b, &body) == nil && body.Message != "" {
+		message = body.Message
+	}
+	return &apiError{Method: req.Method, Path: req.URL.Path, StatusCode: resp.StatusCode, Message: message}
+}
+
+func repoPath(owner, repo string) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(repo))
+}
+
+// retry calls fn until it succeeds, returns error that is not transient or retries are exhausted
+func (c Client) retry(ctx context.Context, operation string, fn func() error) error {
+	return c.retryConfig.Do(ctx, c.log, operation, fn, isTransientError)
+}
+
+// isTransientError returns true for errors that can succeed on retry - server errors, rate limits and network errors
+func isTransientError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests, 0
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return false, 0
+	}
+	// network errors, timeouts ...
+	return true, 0
+}
@@ -0,0 +1,281 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const repoApiPath = "/api/v1/repos/owner/app"
+
+func TestCreateRelease(t *testing.T) {
+	server := newTestServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+	release := testRelease(t)
+
+	releaseId, err := client.CreateRelease(context.Background(), release, false)
+	if err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	if releaseId != 1 || len(server.releases) != 1 {
+		t.Fatalf("expected release with id 1 to be created, got id %d and %d releases", releaseId, len(server.releases))
+	}
+
+	// existing release is reused
+	existingId, err := client.CreateRelease(context.Background(), release, false)
+	if err != nil {
+		t.Fatalf("create existing release: %v", err)
+	}
+	if existingId != releaseId || len(server.releases) != 1 {
+		t.Errorf("expected existing release %d to be reused, got id %d and %d releases", releaseId, existingId, len(server.releases))
+	}
+
+	// dry run does not create release
+	release.Tag = "app-2.0.0"
+	if _, err := client.CreateRelease(context.Background(), release, true); err != nil {
+		t.Fatalf("create release dry run: %v", err)
+	}
+	if len(server.releases) != 1 {
+		t.Errorf("expected no release to be created by dry run, got %d releases", len(server.releases))
+	}
+}
+
+func TestUploadAsset(t *testing.T) {
+	server := newTestServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+	release := testRelease(t)
+
+	releaseId, err := client.CreateRelease(context.Background(), release, false)
+	if err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	uploaded, err := client.UploadAsset(context.Background(), releaseId, release)
+	if err != nil {
+		t.Fatalf("upload asset: %v", err)
+	}
+	if uploaded.ReleaseId != releaseId || uploaded.AssetUrl != ts.URL+"/owner/app/releases/download/app-1.0.0/app-1.0.0.tgz" {
+		t.Errorf("unexpected uploaded asset %+v", uploaded)
+	}
+	assertAssets(t, server, releaseId, "app-1.0.0.tgz=chart")
+
+	// existing asset is skipped
+	writeFile(t, release.AssetPath, "changed chart")
+	if _, err := client.UploadAsset(context.Background(), releaseId, release); err != nil {
+		t.Fatalf("upload existing asset: %v", err)
+	}
+	assertAssets(t, server, releaseId, "app-1.0.0.tgz=chart")
+
+	// force deletes existing asset and uploads it again
+	release.Force = true
+	if _, err := client.UploadAsset(context.Background(), releaseId, release); err != nil {
+		t.Fatalf("force upload asset: %v", err)
+	}
+	assertAssets(t, server, releaseId, "app-1.0.0.tgz=changed chart")
+	if server.deleted != 1 {
+		t.Errorf("expected 1 deleted asset, got %d", server.deleted)
+	}
+}
+
+func TestCreateReleaseAndUploadAssetReuseAfterLostResponse(t *testing.T) {
+	server := newTestServer()
+	// release and asset are created, but the first create and upload responses are lost
+	server.lostResponses = 2
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+	release := testRelease(t)
+
+	releaseId, err := client.CreateRelease(context.Background(), release, false)
+	if err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	if releaseId != 1 || len(server.releases) != 1 {
+		t.Fatalf("expected release with id 1 to be reused, got id %d and %d releases", releaseId, len(server.releases))
+	}
+	uploaded, err := client.UploadAsset(context.Background(), releaseId, release)
+	if err != nil {
+		t.Fatalf("upload asset: %v", err)
+	}
+	if uploaded.AssetUrl != ts.URL+"/owner/app/releases/download/app-1.0.0/app-1.0.0.tgz" {
+		t.Errorf("unexpected uploaded asset %+v", uploaded)
+	}
+	assertAssets(t, server, releaseId, "app-1.0.0.tgz=chart")
+}
+
+func newTestClient(t *testing.T, url string) Client {
+	t.Helper()
+	client, err := NewClient(zap.NewNop(), "token", DefaultApiUrl(url), utils.Retry{Retries: 1, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return client
+}
+
+func testRelease(t *testing.T) forge.Release {
+	t.Helper()
+	assetPath := filepath.Join(t.TempDir(), "app-1.0.0.tgz")
+	writeFile(t, assetPath, "chart")
+	return forge.Release{Owner: "owner", Repo: "app", Tag: "app-1.0.0", Name: "app-1.0.0", AssetPath: assetPath}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertAssets checks release assets, expected assets are in name=content format
+func assertAssets(t *testing.T, server *testServer, releaseId int64, expected ...string) {
+	t.Helper()
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	var actual []string
+	for _, asset := range server.releases[releaseId].Assets {
+		actual = append(actual, asset.Name+"="+server.contents[asset.Id])
+	}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected assets %v, got %v", expected, actual)
+	}
+}
+
+// testServer is Gitea api stand-in for owner/app repository
+type testServer struct {
+	mu       sync.Mutex
+	releases map[int64]*releaseResponse
+	contents map[int64]string
+	nextId   int64
+	deleted  int
+	// lostResponses is number of create release and upload asset requests that succeed, but respond with 502
+	lostResponses int
+}
+
+func newTestServer() *testServer {
+	return &testServer{releases: make(map[int64]*releaseResponse), contents: make(map[int64]string)}
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "token token" {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+	baseUrl := "http://" + r.Host
+
+	path := strings.TrimPrefix(r.URL.Path, repoApiPath)
+	var releaseId, assetId int64
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/releases/tags/"):
+		tag := strings.TrimPrefix(path, "/releases/tags/")
+		for _, release := range s.releases {
+			if release.TagName == tag {
+				writeJson(w, http.StatusOK, release)
+				return
+			}
+		}
+		writeJson(w, http.StatusNotFound, map[string]string{"message": "release not found"})
+	case r.Method == http.MethodPost && path == "/releases":
+		var request map[string]any
+		json.NewDecoder(r.Body).Decode(&request)
+		tag := fmt.Sprint(request["tag_name"])
+		for _, release := range s.releases {
+			if release.TagName == tag {
+				writeJson(w, http.StatusConflict, map[string]string{"message": "release already exists"})
+				return
+			}
+		}
+		s.nextId++
+		s.releases[s.nextId] = &releaseResponse{Id: s.nextId, TagName: tag, HtmlUrl: baseUrl + "/owner/app/releases/tag/" + tag}
+		if s.loseResponse(w) {
+			return
+		}
+		writeJson(w, http.StatusCreated, s.releases[s.nextId])
+	case r.Method == http.MethodGet && scan(path, "/releases/%d", &releaseId):
+		release, ok := s.releases[releaseId]
+		if !ok {
+			writeJson(w, http.StatusNotFound, map[string]string{"message": "release not found"})
+			return
+		}
+		writeJson(w, http.StatusOK, release)
+	case r.Method == http.MethodPost && scan(path, "/releases/%d/assets", &releaseId):
+		file, header, err := r.FormFile("attachment")
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+		b, _ := io.ReadAll(file)
+		release := s.releases[releaseId]
+		s.nextId++
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = header.Filename
+		}
+		asset := assetResponse{Id: s.nextId, Name: name, BrowserDownloadUrl: baseUrl + "/owner/app/releases/download/" + release.TagName + "/" + name}
+		release.Assets = append(release.Assets, asset)
+		s.contents[asset.Id] = string(b)
+		if s.loseResponse(w) {
+			return
+		}
+		writeJson(w, http.StatusCreated, asset)
+	case r.Method == http.MethodDelete && scan(path, "/releases/%d/assets/%d", &releaseId, &assetId):
+		release := s.releases[releaseId]
+		for i, asset := range release.Assets {
+			if asset.Id == assetId {
+				release.Assets = append(release.Assets[:i], release.Assets[i+1:]...)
+				s.deleted++
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeJson(w, http.StatusNotFound, map[string]string{"message": "asset not found"})
+	default:
+		writeJson(w, http.StatusNotFound, map[string]string{"message": "not found"})
+	}
+}
+
+// loseResponse responds with 502 if there are lost responses left
+func (s *testServer) loseResponse(w http.ResponseWriter) bool {
+	if s.lostResponses == 0 {
+		return false
+	}
+	s.lostResponses--
+	writeJson(w, http.StatusBadGateway, map[string]string{"message": "bad gateway"})
+	return true
+}
+
+// scan returns true if the path matches the format exactly
+func scan(path, format string, args ...any) bool {
+	n, err := fmt.Sscanf(path, format, args...)
+	return err == nil && n == len(args) && fmt.Sprintf(format, derefAll(args)...) == path
+}
+
+func derefAll(args []any) []any {
+	var values []any
+	for _, arg := range args {
+		values = append(values, *arg.(*int64))
+	}
+	return values
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -2,42 +2,75 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/go-github/v36/github"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/utils"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 )
 
-const httpTimeout = 5 * time.Second
+const (
+	httpTimeout = 5 * time.Second
+	// downloadTimeout is timeout of the release asset download (asset is downloaded from the redirect url)
+	downloadTimeout = 5 * time.Minute
+)
 
 type Client struct {
-	gh  *github.Client
-	log *zap.Logger
+	gh *github.Client
+	// apiUrl is GitHub Enterprise Server api url, empty for github.com
+	apiUrl      string
+	retryConfig utils.Retry
+	log         *zap.Logger
 }
 
-// NewClient returns "logged in" GitHub client if the token is not empty.
-func NewClient(log *zap.Logger, token string) Client {
-	if token == "" {
-		return Client{log: log, gh: github.NewClient(&http.Client{Timeout: httpTimeout})}
+// NewClient returns "logged in" GitHub client if the token is not empty. Failed API calls are retried according to
+// the retry config. If the api url is set, GitHub Enterprise Server client is returned.
+func NewClient(log *zap.Logger, token, apiUrl string, retryConfig utils.Retry) (Client, error) {
+	httpClient := &http.Client{Timeout: httpTimeout}
+	if token != "" {
+		ts := oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: token},
+		)
+		httpClient = oauth2.NewClient(context.Background(), ts)
+		httpClient.Timeout = httpTimeout
 	}
 
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(context.Background(), ts)
-	tc.Timeout = httpTimeout
-	return Client{log: log, gh: github.NewClient(tc)}
+	if apiUrl == "" {
+		return Client{log: log, retryConfig: retryConfig, gh: github.NewClient(httpClient)}, nil
+	}
+	gh, err := github.NewEnterpriseClient(apiUrl, apiUrl, httpClient)
+	if err != nil {
+		return Client{}, fmt.Errorf("new github enterprise client: %w", err)
+	}
+	return Client{log: log, retryConfig: retryConfig, gh: gh, apiUrl: apiUrl}, nil
+}
+
+// PagesUrl returns GitHub pages url https://<owner>.github.io/<repo>, pages domain of the GitHub Enterprise Server is
+// not known
+func (c Client) PagesUrl(owner, repo string) (string, error) {
+	if c.apiUrl != "" {
+		u, _ := url.Parse(c.apiUrl)
+		return "", fmt.Errorf("pages url of github enterprise server %s cannot be derived, pages url has to be set", u.Host)
+	}
+	return fmt.Sprintf("https://%s.github.io/%s", owner, repo), nil
 }
 
 // ReleaseAndAssetExists checks if the release and asset already exists
 func (c Client) ReleaseAndAssetExists(ctx context.Context, owner, repo, tag, assetPath string) (bool, bool, error) {
-	release, _, err := c.gh.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+	release, err := c.getReleaseByTag(ctx, owner, repo, tag)
 	if err != nil {
 		// release does not exist (no assets)
-		if ghError, ok := err.(*github.ErrorResponse); ok && ghError.Response.StatusCode == http.StatusNotFound {
+		if isNotFound(err) {
 			return false, false, nil
 		}
 	}
@@ -54,17 +87,14 @@ func (c Client) ReleaseAndAssetExists(ctx context.Context, owner, repo, tag, ass
 }
 
 // CreateRelease creates release (if it doesn't exist) and returns release id
-func (c Client) CreateRelease(ctx context.Context, release Release, dryRun bool) (int64, error) {
-	existingRelease, _, err := c.gh.Repositories.GetReleaseByTag(ctx, release.Owner, release.Repo, release.Tag)
+func (c Client) CreateRelease(ctx context.Context, release forge.Release, dryRun bool) (int64, error) {
+	existingRelease, err := c.getReleaseByTag(ctx, release.Owner, release.Repo, release.Tag)
 	if err == nil {
 		c.log.Info(fmt.Sprintf("%s release %s already exists, skipping create release", release.Name, release.Tag))
 		return existingRelease.GetID(), nil
 	}
-	if err != nil {
-		// not a gitHub error and not 404
-		if ghError, ok := err.(*github.ErrorResponse); !ok || ghError.Response.StatusCode != http.StatusNotFound {
-			return 0, fmt.Errorf("get release by %s tag: %w", release.Tag, err)
-		}
+	if !isNotFound(err) {
+		return 0, fmt.Errorf("get release by %s tag: %w", release.Tag, err)
 	}
 	if dryRun {
 		c.log.Info(fmt.Sprintf("%s create release %s skipping, dry run is set to true", release.Name, release.Tag))
@@ -78,7 +108,26 @@ func (c Client) CreateRelease(ctx context.Context, release Release, dryRun bool)
 		Prerelease: &release.PreRelease,
 	}
 
-	response, _, err := c.gh.Repositories.CreateRelease(ctx, release.Owner, release.Repo, request)
+	var response *github.RepositoryRelease
+	var attempt int
+	err = c.retry(ctx, fmt.Sprintf("%s create release %s", release.Name, release.Tag), func() error {
+		attempt++
+		// create is not idempotent, previous attempt could have created the release and only the response was lost
+		if attempt > 1 {
+			existing, _, err := c.gh.Repositories.GetReleaseByTag(ctx, release.Owner, release.Repo, release.Tag)
+			if err == nil {
+				c.log.Info(fmt.Sprintf("%s release %s created by previous attempt, reusing it", release.Name, release.Tag))
+				response = existing
+				return nil
+			}
+			if !isNotFound(err) {
+				return err
+			}
+		}
+		var err error
+		response, _, err = c.gh.Repositories.CreateRelease(ctx, release.Owner, release.Repo, request)
+		return err
+	})
 	if err != nil {
 		return 0, fmt.Errorf("%s create release %s: %w", release.Name, release.Tag, err)
 	}
@@ -86,26 +135,254 @@ func (c Client) CreateRelease(ctx context.Context, release Release, dryRun bool)
 	return response.GetID(), nil
 }
 
-// UploadAsset upload asset and return asset download url
-func (c Client) UploadAsset(ctx context.Context, releaseId int64, release Release) (string, error) {
-	existingRelease, _, err := c.gh.Repositories.GetRelease(ctx, release.Owner, release.Repo, releaseId)
+// UploadAsset upload asset (and provenance file if it is set) and return uploaded asset with its release
+func (c Client) UploadAsset(ctx context.Context, releaseId int64, release forge.Release) (forge.UploadedAsset, error) {
+	var existingRelease *github.RepositoryRelease
+	err := c.retry(ctx, fmt.Sprintf("get release %d", releaseId), func() error {
+		var err error
+		existingRelease, _, err = c.gh.Repositories.GetRelease(ctx, release.Owner, release.Repo, releaseId)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("get release by %d id: %w", releaseId, err)
+		return forge.UploadedAsset{}, fmt.Errorf("get release by %d id: %w", releaseId, err)
 	}
+
+	assetUrl, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, release.AssetPath, release.AssetPath)
+	if err != nil {
+		return forge.UploadedAsset{}, err
+	}
+	// helm looks for provenance file at the chart url with .prov suffix, asset is uploaded to the same release
+	if release.ProvenancePath != "" {
+		if _, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, release.ProvenancePath, release.ProvenancePath); err != nil {
+			return forge.UploadedAsset{}, fmt.Errorf("upload provenance file: %w", err)
+		}
+	}
+	for _, extraAsset := range release.ExtraAssets {
+		if _, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, extraAsset, filepath.Base(extraAsset)); err != nil {
+			return forge.UploadedAsset{}, fmt.Errorf("upload extra asset: %w", err)
+		}
+	}
+	return forge.UploadedAsset{ReleaseId: existingRelease.GetID(), ReleaseUrl: existingRelease.GetHTMLURL(), AssetUrl: assetUrl}, nil
+}
+
+// uploadAssetIfNotExists uploads asset if it does not exist in the release, if the release force is set, existing
+// asset is deleted and uploaded again
+func (c Client) uploadAssetIfNotExists(ctx context.Context, existingRelease *github.RepositoryRelease, release forge.Release, assetPath, assetName string) (string, error) {
 	for _, asset := range existingRelease.Assets {
-		if asset != nil && asset.GetName() == release.AssetPath {
+		if asset == nil || asset.GetName() != assetName {
+			continue
+		}
+		if !release.Force {
 			c.log.Info(fmt.Sprintf("%s release %s asset %s already exists, skipping create asset", release.Name, release.Tag, asset.GetBrowserDownloadURL()))
 			return asset.GetBrowserDownloadURL(), nil
 		}
+		c.log.Warn(fmt.Sprintf("%s release %s asset %s already exists, force is set, replacing asset", release.Name, release.Tag, asset.GetBrowserDownloadURL()))
+		err := c.retry(ctx, fmt.Sprintf("%s release %s delete asset %s", release.Name, release.Tag, assetName), func() error {
+			_, err := c.gh.Repositories.DeleteReleaseAsset(ctx, release.Owner, release.Repo, asset.GetID())
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("%s release %s delete asset %s: %w", release.Name, release.Tag, assetName, err)
+		}
+	}
+
+	var asset *github.ReleaseAsset
+	var attempt int
+	err := c.retry(ctx, fmt.Sprintf("%s release %s upload asset %s", release.Name, release.Tag, assetPath), func() error {
+		attempt++
+		// upload is not idempotent, previous attempt could have uploaded the asset and only the response was lost
+		if attempt > 1 {
+			existing, err := c.findAsset(ctx, existingRelease.GetID(), release, assetName)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				c.log.Info(fmt.Sprintf("%s release %s asset %s uploaded by previous attempt, reusing it", release.Name, release.Tag, assetName))
+				asset = existing
+				return nil
+			}
+		}
+		var err error
+		asset, err = c.uploadAsset(ctx, existingRelease.GetID(), release, assetPath, assetName)
+		return err
+	})
+	return asset.GetBrowserDownloadURL(), err
+}
+
+// findAsset returns release asset with the name, or nil if the release does not have it
+func (c Client) findAsset(ctx context.Context, releaseId int64, release forge.Release, assetName string) (*github.ReleaseAsset, error) {
+	existingRelease, _, err := c.gh.Repositories.GetRelease(ctx, release.Owner, release.Repo, releaseId)
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range existingRelease.Assets {
+		if asset != nil && asset.GetName() == assetName {
+			return asset, nil
+		}
 	}
+	return nil, nil
+}
 
-	f, err := os.Open(release.AssetPath)
+func (c Client) uploadAsset(ctx context.Context, releaseId int64, release forge.Release, assetPath, assetName string) (*github.ReleaseAsset, error) {
+	f, err := os.Open(assetPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer f.Close()
 
-	opts := &github.UploadOptions{Name: release.AssetPath}
+	opts := &github.UploadOptions{Name: assetName}
 	asset, _, err := c.gh.Repositories.UploadReleaseAsset(ctx, release.Owner, release.Repo, releaseId, opts, f)
-	return asset.GetBrowserDownloadURL(), err
+	return asset, err
+}
+
+// ListReleaseAssets returns assets of all the repository releases, releases are listed page by page
+func (c Client) ListReleaseAssets(ctx context.Context, owner, repo string) ([]forge.ReleaseAsset, error) {
+	var assets []forge.ReleaseAsset
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var releases []*github.RepositoryRelease
+		var response *github.Response
+		err := c.retry(ctx, fmt.Sprintf("list releases page %d", opts.Page), func() error {
+			var err error
+			releases, response, err = c.gh.Repositories.ListReleases(ctx, owner, repo, opts)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list releases: %w", err)
+		}
+
+		for _, release := range releases {
+			for _, asset := range release.Assets {
+				if asset == nil {
+					continue
+				}
+				assets = append(assets, forge.ReleaseAsset{
+					Id:         asset.GetID(),
+					Name:       asset.GetName(),
+					Url:        asset.GetBrowserDownloadURL(),
+					CreatedAt:  asset.GetCreatedAt().Time,
+					ReleaseId:  release.GetID(),
+					ReleaseTag: release.GetTagName(),
+					ReleaseUrl: release.GetHTMLURL(),
+				})
+			}
+		}
+		if response.NextPage == 0 {
+			c.log.Info(fmt.Sprintf("listed %d release assets", len(assets)))
+			return assets, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+// DownloadAsset downloads release asset to the path
+func (c Client) DownloadAsset(ctx context.Context, owner, repo string, asset forge.ReleaseAsset, path string) error {
+	return c.retry(ctx, fmt.Sprintf("download %s release asset %s", asset.ReleaseTag, asset.Name), func() error {
+		rc, _, err := c.gh.Repositories.DownloadReleaseAsset(ctx, owner, repo, asset.Id, &http.Client{Timeout: downloadTimeout})
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, rc)
+		return err
+	})
+}
+
+// DeleteReleaseAssets deletes assets from the release, release is deleted as well if it has no assets left. Release
+// can contain assets of other charts (if the tag does not contain chart name), so only supplied assets are deleted.
+func (c Client) DeleteReleaseAssets(ctx context.Context, owner, repo, tag string, assetNames []string) error {
+	release, err := c.getReleaseByTag(ctx, owner, repo, tag)
+	if err != nil {
+		if isNotFound(err) {
+			c.log.Info(fmt.Sprintf("release %s does not exist, skipping delete", tag))
+			return nil
+		}
+		return fmt.Errorf("get release by %s tag: %w", tag, err)
+	}
+
+	var remaining int
+	for _, asset := range release.Assets {
+		if asset == nil {
+			continue
+		}
+		if !slices.Contains(assetNames, asset.GetName()) {
+			remaining++
+			continue
+		}
+		err := c.retry(ctx, fmt.Sprintf("release %s delete asset %s", tag, asset.GetName()), func() error {
+			_, err := c.gh.Repositories.DeleteReleaseAsset(ctx, owner, repo, asset.GetID())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("release %s delete asset %s: %w", tag, asset.GetName(), err)
+		}
+		c.log.Info(fmt.Sprintf("release %s asset %s deleted", tag, asset.GetName()))
+	}
+	if remaining > 0 {
+		c.log.Info(fmt.Sprintf("release %s has %d other assets, skipping delete release", tag, remaining))
+		return nil
+	}
+
+	err = c.retry(ctx, fmt.Sprintf("delete release %s", tag), func() error {
+		_, err := c.gh.Repositories.DeleteRelease(ctx, owner, repo, release.GetID())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("delete release %s: %w", tag, err)
+	}
+	c.log.Info(fmt.Sprintf("release %s deleted", tag))
+	return nil
+}
+
+// YankRelease marks release as pre-release (if preRelease is set) and prepends notice to the release body (if notice
+// is not empty and the body does not start with it already)
+func (c Client) YankRelease(ctx context.Context, owner, repo, tag string, preRelease bool, notice string) error {
+	release, err := c.getReleaseByTag(ctx, owner, repo, tag)
+	if err != nil {
+		return fmt.Errorf("get release by %s tag: %w", tag, err)
+	}
+
+	update := &github.RepositoryRelease{}
+	if preRelease && !release.GetPrerelease() {
+		update.Prerelease = &preRelease
+	}
+	if notice != "" && !strings.HasPrefix(release.GetBody(), notice) {
+		body := fmt.Sprintf("%s\n\n%s", notice, release.GetBody())
+		update.Body = &body
+	}
+	if update.Prerelease == nil && update.Body == nil {
+		c.log.Info(fmt.Sprintf("release %s is already yanked, skipping edit release", tag))
+		return nil
+	}
+
+	err = c.retry(ctx, fmt.Sprintf("edit release %s", tag), func() error {
+		_, _, err := c.gh.Repositories.EditRelease(ctx, owner, repo, release.GetID(), update)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("edit release %s: %w", tag, err)
+	}
+	c.log.Info(fmt.Sprintf("release %s yanked", tag))
+	return nil
+}
+
+func (c Client) getReleaseByTag(ctx context.Context, owner, repo, tag string) (*github.RepositoryRelease, error) {
+	var release *github.RepositoryRelease
+	err := c.retry(ctx, fmt.Sprintf("get release by %s tag", tag), func() error {
+		var err error
+		release, _, err = c.gh.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+		return err
+	})
+	return release, err
+}
+
+func isNotFound(err error) bool {
+	var ghErr *github.ErrorResponse
+	return errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound
 }
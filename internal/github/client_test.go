@@ -0,0 +1,126 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/go-github/v36/github"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPagesUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		apiUrl      string
+		expectedUrl string
+		expectedErr bool
+	}{
+		{name: "github.com", expectedUrl: "https://owner.github.io/repo"},
+		{name: "enterprise server", apiUrl: "https://github.example.com/api/v3/", expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(zap.NewNop(), "", tt.apiUrl, utils.Retry{})
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+			actual, err := client.PagesUrl("owner", "repo")
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error %t, got %v", tt.expectedErr, err)
+			}
+			if actual != tt.expectedUrl {
+				t.Errorf("expected %s, got %s", tt.expectedUrl, actual)
+			}
+		})
+	}
+}
+
+func TestCreateReleaseAndUploadAssetReuseAfterLostResponse(t *testing.T) {
+	server := &lostResponseServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client, err := NewClient(zap.NewNop(), "token", ts.URL, utils.Retry{Retries: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	assetPath := filepath.Join(t.TempDir(), "app-1.0.0.tgz")
+	if err := os.WriteFile(assetPath, []byte("chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	release := forge.Release{Owner: "owner", Repo: "repo", Tag: "app-1.0.0", Name: "app-1.0.0", AssetPath: assetPath}
+
+	releaseId, err := client.CreateRelease(context.Background(), release, false)
+	if err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	if releaseId != 1 {
+		t.Errorf("expected release id 1, got %d", releaseId)
+	}
+	uploaded, err := client.UploadAsset(context.Background(), releaseId, release)
+	if err != nil {
+		t.Fatalf("upload asset: %v", err)
+	}
+	// asset name is the asset path
+	if uploaded.AssetUrl != "https://example.com/"+assetPath {
+		t.Errorf("unexpected asset url %s", uploaded.AssetUrl)
+	}
+	if server.creates != 1 || server.uploads != 1 {
+		t.Errorf("expected 1 create and 1 upload, got %d creates and %d uploads", server.creates, server.uploads)
+	}
+}
+
+// lostResponseServer is GitHub api stand-in that creates release (and uploads asset), but responds with 502 to the
+// first create and upload requests
+type lostResponseServer struct {
+	mu      sync.Mutex
+	release *github.RepositoryRelease
+	creates int
+	uploads int
+}
+
+func (s *lostResponseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/owner/repo/releases/tags/app-1.0.0",
+		r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/owner/repo/releases/1":
+		if s.release == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(s.release)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v3/repos/owner/repo/releases":
+		if s.release != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		s.creates++
+		s.release = &github.RepositoryRelease{ID: github.Int64(1), TagName: github.String("app-1.0.0")}
+		w.WriteHeader(http.StatusBadGateway)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/uploads/repos/owner/repo/releases/1/assets":
+		name := r.URL.Query().Get("name")
+		for _, asset := range s.release.Assets {
+			if asset.GetName() == name {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+		}
+		s.uploads++
+		s.release.Assets = append(s.release.Assets, &github.ReleaseAsset{
+			ID:                 github.Int64(1),
+			Name:               github.String(name),
+			BrowserDownloadURL: github.String("https://example.com/" + name),
+		})
+		w.WriteHeader(http.StatusBadGateway)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
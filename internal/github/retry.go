@@ -0,0 +1,51 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-github/v36/github"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+)
+
+// retry calls fn until it succeeds, returns error that is not transient or retries are exhausted
+func (c Client) retry(ctx context.Context, operation string, fn func() error) error {
+	return c.retryConfig.Do(ctx, c.log, operation, fn, isTransientError)
+}
+
+// isTransientError returns true for errors that can succeed on retry - server errors, secondary rate limits and
+// network errors, secondary rate limit retry after is returned as the minimum wait
+func isTransientError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return true, *abuseErr.RetryAfter
+		}
+		return true, 0
+	}
+	// primary rate limit resets after up to an hour, there is no point retrying
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return false, 0
+	}
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) {
+		if ghErr.Response == nil {
+			return false, 0
+		}
+		return ghErr.Response.StatusCode >= http.StatusInternalServerError || ghErr.Response.StatusCode == http.StatusTooManyRequests, 0
+	}
+	// local file errors (e.g. missing asset file) do not change on retry
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return false, 0
+	}
+	// network errors, timeouts ...
+	return true, 0
+}
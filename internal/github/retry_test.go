@@ -0,0 +1,40 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v36/github"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsTransientError(t *testing.T) {
+	_, openErr := os.Open(filepath.Join(t.TempDir(), "missing.tgz"))
+	retryAfter := time.Minute
+	tests := []struct {
+		name          string
+		err           error
+		expected      bool
+		expectedAfter time.Duration
+	}{
+		{name: "canceled", err: context.Canceled, expected: false},
+		{name: "server error", err: &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}, expected: true},
+		{name: "client error", err: &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}}, expected: false},
+		{name: "secondary rate limit", err: &github.AbuseRateLimitError{RetryAfter: &retryAfter}, expected: true, expectedAfter: time.Minute},
+		{name: "primary rate limit", err: &github.RateLimitError{}, expected: false},
+		{name: "missing asset file", err: fmt.Errorf("upload asset: %w", openErr), expected: false},
+		{name: "network error", err: errors.New("connection reset by peer"), expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, after := isTransientError(tt.err)
+			if actual != tt.expected || after != tt.expectedAfter {
+				t.Errorf("expected %t %s, got %t %s", tt.expected, tt.expectedAfter, actual, after)
+			}
+		})
+	}
+}
@@ -0,0 +1,571 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	httpTimeout = 5 * time.Second
+	// uploadTimeout is timeout of the package file upload and release asset download
+	uploadTimeout = 5 * time.Minute
+)
+
+// Client is GitLab REST API (v4) client, charts are uploaded to the generic package registry and linked to the release
+type Client struct {
+	apiUrl      string
+	token       string
+	httpClient  *http.Client
+	retryConfig utils.Retry
+	log         *zap.Logger
+}
+
+// NewClient returns GitLab client for the api url e.g. https://gitlab.com/api/v4, token is sent in PRIVATE-TOKEN
+// header if it is not empty. Failed API calls are retried according to the retry config.
+func NewClient(log *zap.Logger, token, apiUrl string, retryConfig utils.Retry) (Client, error) {
+	u, err := url.Parse(apiUrl)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return Client{}, fmt.Errorf("invalid gitlab api url %q", apiUrl)
+	}
+	return Client{
+		apiUrl:      strings.TrimSuffix(apiUrl, "/"),
+		token:       token,
+		httpClient:  &http.Client{Timeout: uploadTimeout},
+		retryConfig: retryConfig,
+		log:         log,
+	}, nil
+}
+
+// DefaultApiUrl returns GitLab api url of the instance web url e.g. https://gitlab.com
+func DefaultApiUrl(webUrl string) string {
+	return strings.TrimSuffix(webUrl, "/") + "/api/v4"
+}
+
+type releaseResponse struct {
+	Name        string    `json:"name"`
+	TagName     string    `json:"tag_name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	Assets      struct {
+		Links []link `json:"links"`
+	} `json:"assets"`
+	Links struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+type link struct {
+	Id       int64  `json:"id"`
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	LinkType string `json:"link_type,omitempty"`
+}
+
+type project struct {
+	DefaultBranch string `json:"default_branch"`
+}
+
+type packageInfo struct {
+	Id      int64  `json:"id"`
+	Version string `json:"version"`
+}
+
+type packageFile struct {
+	Id       int64  `json:"id"`
+	FileName string `json:"file_name"`
+}
+
+// apiError is non-2xx GitLab API response
+type apiError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// CreateRelease creates release (if it doesn't exist), GitLab releases are identified by tag, so returned release id
+// is always 0. Tag is created from the project default branch if it does not exist.
+func (c Client) CreateRelease(ctx context.Context, release forge.Release, dryRun bool) (int64, error) {
+	if _, err := c.getRelease(ctx, release.Owner, release.Repo, release.Tag); err == nil {
+		c.log.Info(fmt.Sprintf("%s release %s already exists, skipping create release", release.Name, release.Tag))
+		return 0, nil
+	} else if !isNotFound(err) {
+		return 0, fmt.Errorf("get release by %s tag: %w", release.Tag, err)
+	}
+	if dryRun {
+		c.log.Info(fmt.Sprintf("%s create release %s skipping, dry run is set to true", release.Name, release.Tag))
+		return 0, nil
+	}
+	if release.PreRelease {
+		c.log.Warn(fmt.Sprintf("%s release %s: gitlab does not support pre-releases, creating regular release", release.Name, release.Tag))
+	}
+
+	var p project
+	if err := c.do(ctx, http.MethodGet, projectPath(release.Owner, release.Repo), nil, &p); err != nil {
+		return 0, fmt.Errorf("get project %s/%s: %w", release.Owner, release.Repo, err)
+	}
+	request := map[string]string{
+		"name":        release.Name,
+		"tag_name":    release.Tag,
+		"description": release.Description,
+		"ref":         p.DefaultBranch,
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, err
+	}
+	var attempt int
+	err = c.retry(ctx, fmt.Sprintf("%s create release %s", release.Name, release.Tag), func() error {
+		attempt++
+		// create is not idempotent, previous attempt could have created the release and only the response was lost
+		if attempt > 1 {
+			_, err := c.request(ctx, http.MethodGet, c.apiUrl+releasePath(release.Owner, release.Repo, release.Tag), nil, "", nil)
+			if err == nil {
+				c.log.Info(fmt.Sprintf("%s release %s created by previous attempt, reusing it", release.Name, release.Tag))
+				return nil
+			}
+			if !isNotFound(err) {
+				return err
+			}
+		}
+		u := c.apiUrl + projectPath(release.Owner, release.Repo) + "/releases"
+		return c.send(ctx, http.MethodPost, u, bytes.NewReader(body), "application/json", nil)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s create release %s: %w", release.Name, release.Tag, err)
+	}
+	c.log.Info(fmt.Sprintf("%s release %s created", release.Name, release.Tag))
+	return 0, nil
+}
+
+// UploadAsset uploads asset (and provenance file if it is set) to the generic package registry (package name and
+// version are chart name and version) and links it to the release
+func (c Client) UploadAsset(ctx context.Context, _ int64, release forge.Release) (forge.UploadedAsset, error) {
+	existingRelease, err := c.getRelease(ctx, release.Owner, release.Repo, release.Tag)
+	if err != nil {
+		return forge.UploadedAsset{}, fmt.Errorf("get release by %s tag: %w", release.Tag, err)
+	}
+
+	assetUrl, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, release.AssetPath)
+	if err != nil {
+		return forge.UploadedAsset{}, err
+	}
+	// helm looks for provenance file at the chart url with .prov suffix, file is uploaded to the same package
+	if release.ProvenancePath != "" {
+		if _, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, release.ProvenancePath); err != nil {
+			return forge.UploadedAsset{}, fmt.Errorf("upload provenance file: %w", err)
+		}
+	}
+	for _, extraAsset := range release.ExtraAssets {
+		if _, err := c.uploadAssetIfNotExists(ctx, existingRelease, release, extraAsset); err != nil {
+			return forge.UploadedAsset{}, fmt.Errorf("upload extra asset: %w", err)
+		}
+	}
+	return forge.UploadedAsset{ReleaseUrl: existingRelease.Links.Self, AssetUrl: assetUrl}, nil
+}
+
+// uploadAssetIfNotExists uploads package file and creates release link if the link does not exist, if the release
+// force is set, package file is uploaded again (GitLab serves the latest file with the same name)
+func (c Client) uploadAssetIfNotExists(ctx context.Context, existingRelease releaseResponse, release forge.Release, assetPath string) (string, error) {
+	assetName := filepath.Base(assetPath)
+	for _, l := range existingRelease.Assets.Links {
+		if l.Name != assetName {
+			continue
+		}
+		if !release.Force {
+			c.log.Info(fmt.Sprintf("%s release %s asset %s already exists, skipping create asset", release.Name, release.Tag, l.Url))
+			return l.Url, nil
+		}
+		c.log.Warn(fmt.Sprintf("%s release %s asset %s already exists, force is set, replacing asset", release.Name, release.Tag, l.Url))
+		if err := c.uploadPackageFile(ctx, release, assetPath); err != nil {
+			return "", fmt.Errorf("%s release %s upload asset %s: %w", release.Name, release.Tag, assetName, err)
+		}
+		return l.Url, nil
+	}
+
+	if err := c.uploadPackageFile(ctx, release, assetPath); err != nil {
+		return "", fmt.Errorf("%s release %s upload asset %s: %w", release.Name, release.Tag, assetName, err)
+	}
+	assetUrl := c.apiUrl + packageFilePath(release, assetName)
+	body, err := json.Marshal(link{Name: assetName, Url: assetUrl, LinkType: "package"})
+	if err != nil {
+		return "", err
+	}
+	var attempt int
+	err = c.retry(ctx, fmt.Sprintf("%s release %s create asset link %s", release.Name, release.Tag, assetName), func() error {
+		attempt++
+		// create is not idempotent, previous attempt could have created the link and only the response was lost
+		if attempt > 1 {
+			var r releaseResponse
+			if _, err := c.request(ctx, http.MethodGet, c.apiUrl+releasePath(release.Owner, release.Repo, release.Tag), nil, "", &r); err != nil {
+				return err
+			}
+			for _, l := range r.Assets.Links {
+				if l.Name == assetName {
+					c.log.Info(fmt.Sprintf("%s release %s asset link %s created by previous attempt, reusing it", release.Name, release.Tag, assetName))
+					assetUrl = l.Url
+					return nil
+				}
+			}
+		}
+		u := c.apiUrl + releasePath(release.Owner, release.Repo, release.Tag) + "/assets/links"
+		return c.send(ctx, http.MethodPost, u, bytes.NewReader(body), "application/json", nil)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s release %s create asset link %s: %w", release.Name, release.Tag, assetName, err)
+	}
+	c.log.Info(fmt.Sprintf("%s release %s asset %s uploaded", release.Name, release.Tag, assetUrl))
+	return assetUrl, nil
+}
+
+func (c Client) uploadPackageFile(ctx context.Context, release forge.Release, assetPath string) error {
+	operation := fmt.Sprintf("%s release %s upload asset %s", release.Name, release.Tag, assetPath)
+	return c.retry(ctx, operation, func() error {
+		b, err := os.ReadFile(assetPath)
+		if err != nil {
+			return err
+		}
+		return c.send(ctx, http.MethodPut, c.apiUrl+packageFilePath(release, filepath.Base(assetPath)), bytes.NewReader(b), "application/octet-stream", nil)
+	})
+}
+
+// ListReleaseAssets returns asset links of all the project releases, releases are listed page by page. Links have no
+// created time, release created time is used instead.
+func (c Client) ListReleaseAssets(ctx context.Context, owner, repo string) ([]forge.ReleaseAsset, error) {
+	var assets []forge.ReleaseAsset
+	page := "1"
+	for page != "" {
+		var releases []releaseResponse
+		var header http.Header
+		path := fmt.Sprintf("%s/releases?per_page=100&page=%s", projectPath(owner, repo), page)
+		err := c.retry(ctx, fmt.Sprintf("list releases page %s", page), func() error {
+			var err error
+			header, err = c.request(ctx, http.MethodGet, c.apiUrl+path, nil, "", &releases)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list releases: %w", err)
+		}
+
+		for _, r := range releases {
+			for _, l := range r.Assets.Links {
+				assets = append(assets, forge.ReleaseAsset{
+					Id:         l.Id,
+					Name:       l.Name,
+					Url:        l.Url,
+					CreatedAt:  r.CreatedAt,
+					ReleaseTag: r.TagName,
+					ReleaseUrl: r.Links.Self,
+				})
+			}
+		}
+		page = header.Get("X-Next-Page")
+	}
+	c.log.Info(fmt.Sprintf("listed %d release assets", len(assets)))
+	return assets, nil
+}
+
+// DownloadAsset downloads release asset to the path, token is sent only if the asset is hosted on the GitLab instance
+func (c Client) DownloadAsset(ctx context.Context, _, _ string, asset forge.ReleaseAsset, path string) error {
+	return c.retry(ctx, fmt.Sprintf("download %s release asset %s", asset.ReleaseTag, asset.Name), func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.Url, nil)
+		if err != nil {
+			return err
+		}
+		if c.isInstanceUrl(asset.Url) {
+			c.setToken(req)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := checkResponse(req, resp); err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, resp.Body)
+		return err
+	})
+}
+
+// DeleteReleaseAssets deletes asset links and their package files from the release, release is deleted as well if it
+// has no links left. Release can contain assets of other charts (if the tag does not contain chart name), so only
+// supplied assets are deleted.
+func (c Client) DeleteReleaseAssets(ctx context.Context, owner, repo, tag string, assetNames []string) error {
+	existingRelease, err := c.getRelease(ctx, owner, repo, tag)
+	if err != nil {
+		if isNotFound(err) {
+			c.log.Info(fmt.Sprintf("release %s does not exist, skipping delete", tag))
+			return nil
+		}
+		return fmt.Errorf("get release by %s tag: %w", tag, err)
+	}
+
+	releasePath := fmt.Sprintf("%s/releases/%s", projectPath(owner, repo), url.PathEscape(tag))
+	var remaining int
+	for _, l := range existingRelease.Assets.Links {
+		if !slices.Contains(assetNames, l.Name) {
+			remaining++
+			continue
+		}
+		if err := c.deletePackageFile(ctx, owner, repo, l.Url); err != nil {
+			return fmt.Errorf("release %s delete asset %s package file: %w", tag, l.Name, err)
+		}
+		if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/assets/links/%d", releasePath, l.Id), nil, nil); err != nil {
+			return fmt.Errorf("release %s delete asset %s: %w", tag, l.Name, err)
+		}
+		c.log.Info(fmt.Sprintf("release %s asset %s deleted", tag, l.Name))
+	}
+	if remaining > 0 {
+		c.log.Info(fmt.Sprintf("release %s has %d other assets, skipping delete release", tag, remaining))
+		return nil
+	}
+
+	if err := c.do(ctx, http.MethodDelete, releasePath, nil, nil); err != nil {
+		return fmt.Errorf("delete release %s: %w", tag, err)
+	}
+	c.log.Info(fmt.Sprintf("release %s deleted", tag))
+	return nil
+}
+
+// deletePackageFile deletes generic package files the asset url points to, links to other urls are ignored
+func (c Client) deletePackageFile(ctx context.Context, owner, repo, assetUrl string) error {
+	prefix := c.apiUrl + projectPath(owner, repo) + "/packages/generic/"
+	if !strings.HasPrefix(assetUrl, prefix) {
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(assetUrl, prefix), "/")
+	if len(parts) != 3 {
+		return nil
+	}
+	name, _ := url.PathUnescape(parts[0])
+	version, _ := url.PathUnescape(parts[1])
+	fileName, _ := url.PathUnescape(parts[2])
+
+	var packages []packageInfo
+	query := url.Values{"package_type": {"generic"}, "package_name": {name}, "per_page": {"100"}}
+	if err := c.do(ctx, http.MethodGet, projectPath(owner, repo)+"/packages?"+query.Encode(), nil, &packages); err != nil {
+		return fmt.Errorf("list packages: %w", err)
+	}
+	for _, p := range packages {
+		if p.Version != version {
+			continue
+		}
+		var files []packageFile
+		filesPath := fmt.Sprintf("%s/packages/%d/package_files", projectPath(owner, repo), p.Id)
+		if err := c.do(ctx, http.MethodGet, filesPath+"?per_page=100", nil, &files); err != nil {
+			return fmt.Errorf("list package files: %w", err)
+		}
+		for _, f := range files {
+			if f.FileName != fileName {
+				continue
+			}
+			if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/%d", filesPath, f.Id), nil, nil); err != nil {
+				return fmt.Errorf("delete package file %s: %w", fileName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// YankRelease prepends notice to the release description (if notice is not empty and the description does not start
+// with it already), GitLab does not support pre-releases, so preRelease is only logged
+func (c Client) YankRelease(ctx context.Context, owner, repo, tag string, preRelease bool, notice string) error {
+	existingRelease, err := c.getRelease(ctx, owner, repo, tag)
+	if err != nil {
+		return fmt.Errorf("get release by %s tag: %w", tag, err)
+	}
+	if preRelease {
+		c.log.Warn(fmt.Sprintf("release %s: gitlab does not support pre-releases, skipping mark pre-release", tag))
+	}
+	if notice == "" || strings.HasPrefix(existingRelease.Description, notice) {
+		c.log.Info(fmt.Sprintf("release %s is already yanked, skipping edit release", tag))
+		return nil
+	}
+
+	request := map[string]string{"description": fmt.Sprintf("%s\n\n%s", notice, existingRelease.Description)}
+	releasePath := fmt.Sprintf("%s/releases/%s", projectPath(owner, repo), url.PathEscape(tag))
+	if err := c.do(ctx, http.MethodPut, releasePath, request, nil); err != nil {
+		return fmt.Errorf("edit release %s: %w", tag, err)
+	}
+	c.log.Info(fmt.Sprintf("release %s yanked", tag))
+	return nil
+}
+
+// PagesUrl returns gitlab.com pages url https://<top level group>.gitlab.io/<subgroups>/<repo>, pages domain of the
+// self-hosted instance is not known
+func (c Client) PagesUrl(owner, repo string) (string, error) {
+	u, _ := url.Parse(c.apiUrl)
+	if u.Hostname() != "gitlab.com" {
+		return "", fmt.Errorf("pages url of self-hosted gitlab %s cannot be derived, pages url has to be set", u.Host)
+	}
+	group, subgroups, _ := strings.Cut(owner, "/")
+	if subgroups != "" {
+		return fmt.Sprintf("https://%s.gitlab.io/%s/%s", group, subgroups, repo), nil
+	}
+	return fmt.Sprintf("https://%s.gitlab.io/%s", group, repo), nil
+}
+
+func (c Client) getRelease(ctx context.Context, owner, repo, tag string) (releaseResponse, error) {
+	var r releaseResponse
+	err := c.do(ctx, http.MethodGet, releasePath(owner, repo, tag), nil, &r)
+	return r, err
+}
+
+// do sends json request (if in is not nil) to the api path and decodes json response to out (if it is not nil),
+// transient errors are retried
+func (c Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	return c.retry(ctx, fmt.Sprintf("%s %s", method, path), func() error {
+		var r io.Reader
+		var contentType string
+		if body != nil {
+			r, contentType = bytes.NewReader(body), "application/json"
+		}
+		return c.send(ctx, method, c.apiUrl+path, r, contentType, out)
+	})
+}
+
+func (c Client) send(ctx context.Context, method, u string, body io.Reader, contentType string, out any) error {
+	_, err := c.request(ctx, method, u, body, contentType, out)
+	return err
+}
+
+// request sends request with the token and returns response header, json response is decoded to out if it is not nil
+func (c Client) request(ctx context.Context, method, u string, body io.Reader, contentType string, out any) (http.Header, error) {
+	timeout := httpTimeout
+	if method == http.MethodPut && contentType == "application/octet-stream" {
+		timeout = uploadTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.setToken(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(req, resp); err != nil {
+		return nil, err
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("decode %s %s response: %w", method, req.URL.Path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+func (c Client) setToken(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+}
+
+func (c Client) isInstanceUrl(u string) bool {
+	api, _ := url.Parse(c.apiUrl)
+	asset, err := url.Parse(u)
+	return err == nil && asset.Host == api.Host
+}
+
+// checkResponse returns api error if the response status is not 2xx, message is taken from the json response body
+func checkResponse(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var body struct {
+		Message any    `json:"message"`
+		Error   string `json:"error"`
+	}
+	message := strings.TrimSpace(string(b))
+	if json.Unmarshal(b, &body) == nil {
+		if body.Message != nil {
+			message = fmt.Sprint(body.Message)
+		} else if body.Error != "" {
+			message = body.Error
+		}
+	}
+	return &apiError{Method: req.Method, Path: req.URL.Path, StatusCode: resp.StatusCode, Message: message}
+}
+
+// projectPath returns api path of the project, project id is url encoded full path e.g. group%2Fsubgroup%2Fproject
+func projectPath(owner, repo string) string {
+	return "/projects/" + url.PathEscape(owner+"/"+repo)
+}
+
+// releasePath returns api path of the release, releases are identified by tag
+func releasePath(owner, repo, tag string) string {
+	return fmt.Sprintf("%s/releases/%s", projectPath(owner, repo), url.PathEscape(tag))
+}
+
+// packageFilePath returns api path of the generic package file, package name and version are chart name and version
+func packageFilePath(release forge.Release, fileName string) string {
+	return fmt.Sprintf("%s/packages/generic/%s/%s/%s", projectPath(release.Owner, release.Repo),
+		url.PathEscape(release.ChartName), url.PathEscape(release.ChartVersion), url.PathEscape(fileName))
+}
+
+// retry calls fn until it succeeds, returns error that is not transient or retries are exhausted
+func (c Client) retry(ctx context.Context, operation string, fn func() error) error {
+	return c.retryConfig.Do(ctx, c.log, operation, fn, isTransientError)
+}
+
+// isTransientError returns true for errors that can succeed on retry - server errors, rate limits and network errors
+func isTransientError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests, 0
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return false, 0
+	}
+	// network errors, timeouts ...
+	return true, 0
+}
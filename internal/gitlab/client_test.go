@@ -0,0 +1,312 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// projectApiPath is escaped api path of group/subgroup/app project
+const projectApiPath = "/api/v4/projects/group%2Fsubgroup%2Fapp"
+
+func TestCreateReleaseAndUploadAsset(t *testing.T) {
+	server := newTestServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	release := testRelease(t)
+	if _, err := client.CreateRelease(context.Background(), release, false); err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	if _, ok := server.releases["app-1.0.0"]; !ok {
+		t.Fatal("expected app-1.0.0 release to be created")
+	}
+	if ref := server.refs["app-1.0.0"]; ref != "main" {
+		t.Errorf("expected release tag to be created from main branch, got %q", ref)
+	}
+
+	uploaded, err := client.UploadAsset(context.Background(), 0, release)
+	if err != nil {
+		t.Fatalf("upload asset: %v", err)
+	}
+	expectedUrl := ts.URL + projectApiPath + "/packages/generic/app/1.0.0/app-1.0.0.tgz"
+	if uploaded.AssetUrl != expectedUrl {
+		t.Errorf("expected asset url %s, got %s", expectedUrl, uploaded.AssetUrl)
+	}
+	if content := server.packageFiles[projectApiPath+"/packages/generic/app/1.0.0/app-1.0.0.tgz"]; content != "chart" {
+		t.Errorf("expected uploaded package file content chart, got %q", content)
+	}
+
+	// release and asset already exist
+	if _, err := client.CreateRelease(context.Background(), release, false); err != nil {
+		t.Fatalf("create existing release: %v", err)
+	}
+	if _, err := client.UploadAsset(context.Background(), 0, release); err != nil {
+		t.Fatalf("upload existing asset: %v", err)
+	}
+	if uploads := server.uploads; uploads != 1 {
+		t.Errorf("expected existing asset not to be uploaded again, got %d uploads", uploads)
+	}
+	if links := len(server.releases["app-1.0.0"].Assets.Links); links != 1 {
+		t.Errorf("expected 1 release link, got %d", links)
+	}
+
+	// force uploads package file again, link is kept
+	release.Force = true
+	if _, err := client.UploadAsset(context.Background(), 0, release); err != nil {
+		t.Fatalf("force upload asset: %v", err)
+	}
+	if uploads := server.uploads; uploads != 2 {
+		t.Errorf("expected forced asset to be uploaded again, got %d uploads", uploads)
+	}
+	if links := len(server.releases["app-1.0.0"].Assets.Links); links != 1 {
+		t.Errorf("expected 1 release link, got %d", links)
+	}
+}
+
+func TestCreateReleaseAndUploadAssetReuseAfterLostResponse(t *testing.T) {
+	server := newTestServer()
+	// release and link are created, but the first create release and create link responses are lost
+	server.lostResponses = 2
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	release := testRelease(t)
+	if _, err := client.CreateRelease(context.Background(), release, false); err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	uploaded, err := client.UploadAsset(context.Background(), 0, release)
+	if err != nil {
+		t.Fatalf("upload asset: %v", err)
+	}
+	expectedUrl := ts.URL + projectApiPath + "/packages/generic/app/1.0.0/app-1.0.0.tgz"
+	if uploaded.AssetUrl != expectedUrl {
+		t.Errorf("expected asset url %s, got %s", expectedUrl, uploaded.AssetUrl)
+	}
+	if links := len(server.releases["app-1.0.0"].Assets.Links); links != 1 {
+		t.Errorf("expected 1 release link, got %d", links)
+	}
+}
+
+func TestCreateReleaseDryRun(t *testing.T) {
+	server := newTestServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	if _, err := client.CreateRelease(context.Background(), testRelease(t), true); err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	if len(server.releases) != 0 {
+		t.Errorf("expected no release to be created, got %d", len(server.releases))
+	}
+}
+
+func TestListReleaseAssets(t *testing.T) {
+	server := newTestServer()
+	for i := 1; i <= 3; i++ {
+		tag := fmt.Sprintf("app-1.0.%d", i)
+		r := releaseResponse{TagName: tag, CreatedAt: time.Date(2024, 1, i, 0, 0, 0, 0, time.UTC)}
+		r.Assets.Links = []link{{Id: int64(i), Name: tag + ".tgz", Url: "https://example.com/" + tag + ".tgz"}}
+		server.releases[tag] = r
+		server.order = append(server.order, tag)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := newTestClient(t, ts.URL)
+
+	assets, err := client.ListReleaseAssets(context.Background(), "group/subgroup", "app")
+	if err != nil {
+		t.Fatalf("list release assets: %v", err)
+	}
+	if len(assets) != 3 {
+		t.Fatalf("expected 3 assets from 3 pages, got %d", len(assets))
+	}
+	for i, asset := range assets {
+		tag := fmt.Sprintf("app-1.0.%d", i+1)
+		if asset.ReleaseTag != tag || asset.Name != tag+".tgz" || asset.CreatedAt.Day() != i+1 {
+			t.Errorf("unexpected asset %d: %+v", i, asset)
+		}
+	}
+	if server.listed != 3 {
+		t.Errorf("expected 3 list pages requests, got %d", server.listed)
+	}
+}
+
+func TestPagesUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		apiUrl      string
+		owner       string
+		expectedUrl string
+		expectedErr bool
+	}{
+		{name: "group", apiUrl: "https://gitlab.com/api/v4", owner: "group", expectedUrl: "https://group.gitlab.io/app"},
+		{name: "nested groups", apiUrl: "https://gitlab.com/api/v4", owner: "group/subgroup", expectedUrl: "https://group.gitlab.io/subgroup/app"},
+		{name: "self-hosted", apiUrl: "https://gitlab.example.com/api/v4", owner: "group", expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.apiUrl)
+			actual, err := client.PagesUrl(tt.owner, "app")
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error %t, got %v", tt.expectedErr, err)
+			}
+			if actual != tt.expectedUrl {
+				t.Errorf("expected %s, got %s", tt.expectedUrl, actual)
+			}
+		})
+	}
+}
+
+func newTestClient(t *testing.T, url string) Client {
+	t.Helper()
+	client, err := NewClient(zap.NewNop(), "token", DefaultApiUrl(url), utils.Retry{Retries: 1, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return client
+}
+
+func testRelease(t *testing.T) forge.Release {
+	t.Helper()
+	assetPath := filepath.Join(t.TempDir(), "app-1.0.0.tgz")
+	if err := os.WriteFile(assetPath, []byte("chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return forge.Release{
+		Owner:        "group/subgroup",
+		Repo:         "app",
+		Tag:          "app-1.0.0",
+		Name:         "app-1.0.0",
+		ChartName:    "app",
+		ChartVersion: "1.0.0",
+		AssetPath:    assetPath,
+	}
+}
+
+// testServer is GitLab api stand-in for group/subgroup/app project, one release is returned per list page
+type testServer struct {
+	mu           sync.Mutex
+	releases     map[string]releaseResponse
+	order        []string
+	refs         map[string]string
+	packageFiles map[string]string
+	uploads      int
+	listed       int
+	// lostResponses is number of create release and create link requests that succeed, but respond with 502
+	lostResponses int
+}
+
+func newTestServer() *testServer {
+	return &testServer{
+		releases:     make(map[string]releaseResponse),
+		refs:         make(map[string]string),
+		packageFiles: make(map[string]string),
+	}
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("PRIVATE-TOKEN") != "token" {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"message": "401 Unauthorized"})
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, projectApiPath) {
+		writeJson(w, http.StatusNotFound, map[string]string{"message": "404 Project Not Found"})
+		return
+	}
+	path = strings.TrimPrefix(path, projectApiPath)
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		writeJson(w, http.StatusOK, project{DefaultBranch: "main"})
+	case r.Method == http.MethodGet && path == "/releases":
+		s.listReleases(w, r)
+	case r.Method == http.MethodPost && path == "/releases":
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		if _, ok := s.releases[request["tag_name"]]; ok {
+			writeJson(w, http.StatusConflict, map[string]string{"message": "Release already exists"})
+			return
+		}
+		s.releases[request["tag_name"]] = releaseResponse{Name: request["name"], TagName: request["tag_name"], Description: request["description"]}
+		s.refs[request["tag_name"]] = request["ref"]
+		if s.loseResponse(w) {
+			return
+		}
+		writeJson(w, http.StatusCreated, s.releases[request["tag_name"]])
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/releases/"):
+		release, ok := s.releases[strings.TrimPrefix(path, "/releases/")]
+		if !ok {
+			writeJson(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+			return
+		}
+		writeJson(w, http.StatusOK, release)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/releases/") && strings.HasSuffix(path, "/assets/links"):
+		tag := strings.TrimSuffix(strings.TrimPrefix(path, "/releases/"), "/assets/links")
+		release := s.releases[tag]
+		var l link
+		json.NewDecoder(r.Body).Decode(&l)
+		l.Id = int64(len(release.Assets.Links) + 1)
+		release.Assets.Links = append(release.Assets.Links, l)
+		s.releases[tag] = release
+		if s.loseResponse(w) {
+			return
+		}
+		writeJson(w, http.StatusCreated, l)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/packages/generic/"):
+		b, _ := io.ReadAll(r.Body)
+		s.packageFiles[projectApiPath+path] = string(b)
+		s.uploads++
+		writeJson(w, http.StatusCreated, map[string]string{"message": "201 Created"})
+	default:
+		writeJson(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+	}
+}
+
+// loseResponse responds with 502 if there are lost responses left
+func (s *testServer) loseResponse(w http.ResponseWriter) bool {
+	if s.lostResponses == 0 {
+		return false
+	}
+	s.lostResponses--
+	writeJson(w, http.StatusBadGateway, map[string]string{"message": "502 Bad Gateway"})
+	return true
+}
+
+func (s *testServer) listReleases(w http.ResponseWriter, r *http.Request) {
+	s.listed++
+	var page int
+	fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+	if page < 1 || page > len(s.order) {
+		writeJson(w, http.StatusOK, []releaseResponse{})
+		return
+	}
+	if page < len(s.order) {
+		w.Header().Set("X-Next-Page", fmt.Sprint(page+1))
+	}
+	writeJson(w, http.StatusOK, []releaseResponse{s.releases[s.order[page-1]]})
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,123 @@
+package hcr
+
+import (
+	"fmt"
+	"github.com/pete911/hcr/internal/git"
+	"helm.sh/helm/v3/pkg/repo"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+const (
+	// artifactHubRepoFileName is Artifact Hub repository metadata file, it is committed together with the index file
+	artifactHubRepoFileName = "artifacthub-repo.yml"
+	// artifactHubChangesAnnotation is chart annotation with the chart version changes
+	artifactHubChangesAnnotation = "artifacthub.io/changes"
+)
+
+// artifactHubChangeKinds maps conventional commit types to Artifact Hub change kinds, other commits are 'changed'
+var artifactHubChangeKinds = map[string]string{
+	"feat": "added",
+	"fix":  "fixed",
+}
+
+// ArtifactHubConfig is Artifact Hub repository metadata, Changes adds 'artifacthub.io/changes' annotation generated
+// from git history to the packaged charts
+type ArtifactHubConfig struct {
+	RepositoryId string
+	Owners       []ArtifactHubOwner
+	Ignore       []ArtifactHubIgnore
+	Changes      bool
+}
+
+// Enabled returns true if Artifact Hub repository metadata file should be written
+func (a ArtifactHubConfig) Enabled() bool {
+	return a.RepositoryId != "" || len(a.Owners) > 0 || len(a.Ignore) > 0
+}
+
+type ArtifactHubOwner struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// ArtifactHubIgnore ignores chart versions matching version regular expression, all the versions are ignored if the
+// version is empty
+type ArtifactHubIgnore struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type artifactHubRepo struct {
+	RepositoryId string              `json:"repositoryID,omitempty"`
+	Owners       []ArtifactHubOwner  `json:"owners,omitempty"`
+	Ignore       []ArtifactHubIgnore `json:"ignore,omitempty"`
+}
+
+type artifactHubChange struct {
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+}
+
+// writeArtifactHubRepo writes Artifact Hub repository metadata file to the GitHub pages worktree
+func (r Releaser) writeArtifactHubRepo() error {
+	config := r.config.ArtifactHub
+	b, err := yaml.Marshal(artifactHubRepo{RepositoryId: config.RepositoryId, Owners: config.Owners, Ignore: config.Ignore})
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", artifactHubRepoFileName, err)
+	}
+	if err := os.WriteFile(filepath.Join(r.ghPagesDir, artifactHubRepoFileName), b, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", artifactHubRepoFileName, err)
+	}
+	r.log.Info(fmt.Sprintf("written %s", artifactHubRepoFileName))
+	return nil
+}
+
+// artifactHubAnnotations returns 'artifacthub.io/changes' annotation for every chart (map key is chart path), charts
+// without git history do not have the annotation
+func (r Releaser) artifactHubAnnotations(indexFile *repo.IndexFile, charts []SourceChart) map[string]map[string]string {
+	if !r.config.ArtifactHub.Changes {
+		return nil
+	}
+
+	annotations := make(map[string]map[string]string)
+	for _, ch := range charts {
+		commits, err := r.chartCommits(indexFile, ch)
+		if err != nil {
+			r.log.Warn(fmt.Sprintf("chart %s %s %s annotation: %v, skipping", ch.Name, ch.Version, artifactHubChangesAnnotation, err))
+			continue
+		}
+		if len(commits) == 0 {
+			continue
+		}
+		changes, err := artifactHubChanges(commits)
+		if err != nil {
+			r.log.Warn(fmt.Sprintf("chart %s %s %s annotation: %v, skipping", ch.Name, ch.Version, artifactHubChangesAnnotation, err))
+			continue
+		}
+		annotations[ch.Path] = map[string]string{artifactHubChangesAnnotation: changes}
+	}
+	return annotations
+}
+
+// artifactHubChanges returns commits as Artifact Hub changes yaml, conventional commit type is mapped to change kind
+func artifactHubChanges(commits []git.Commit) (string, error) {
+	var changes []artifactHubChange
+	for _, commit := range commits {
+		description := commit.Subject
+		kind := "changed"
+		if match := conventionalCommitRegex.FindStringSubmatch(commit.Subject); match != nil && isCommitGroup(match[1]) {
+			description = match[3]
+			if k, ok := artifactHubChangeKinds[strings.ToLower(match[1])]; ok {
+				kind = k
+			}
+		}
+		changes = append(changes, artifactHubChange{Kind: kind, Description: description})
+	}
+	b, err := yaml.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,143 @@
+package hcr
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/helm"
+	"helm.sh/helm/v3/pkg/chart"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SourceChart is chart found in the charts dir
+type SourceChart struct {
+	Name    string
+	Version string
+	Path    string
+}
+
+type SkippedChart struct {
+	SourceChart
+	Reason string
+}
+
+// FailedChart is chart that failed validation or release
+type FailedChart struct {
+	SourceChart
+	Reason string
+}
+
+// changedCharts returns charts that should be released and charts that were skipped. Chart is skipped if
+// its version is already released (and force is not set), or (if since ref is set) there are no changes in the chart
+// directory.
+func (r Releaser) changedCharts(released releasedFunc) ([]SourceChart, []SkippedChart, error) {
+	metadata, err := r.helmClient.LoadChartsMetadata(r.config.ChartsDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load charts metadata: %w", err)
+	}
+
+	var changedFiles []string
+	if r.config.Since != "" {
+		changedFiles, err = r.gitClient.ChangedFiles(r.config.ChartsDir, r.config.Since)
+		if err != nil {
+			return nil, nil, fmt.Errorf("git changed files since %s: %w", r.config.Since, err)
+		}
+	}
+
+	var changed []SourceChart
+	var skipped []SkippedChart
+	for _, chartPath := range sortedKeys(metadata) {
+		md := metadata[chartPath]
+		if r.config.Charts[md.Name].Skip {
+			skipped = append(skipped, newSkippedChart(chartPath, md, "skipped by config"))
+			continue
+		}
+		if r.config.Since != "" && !containsPathFile(absPath(chartPath), changedFiles) {
+			reason := fmt.Sprintf("no changes since %s", r.config.Since)
+			skipped = append(skipped, newSkippedChart(chartPath, md, reason))
+			continue
+		}
+		isReleased, err := released(md.Name, md.Version)
+		if err != nil {
+			return nil, nil, fmt.Errorf("chart %s %s: %w", md.Name, md.Version, err)
+		}
+		if isReleased {
+			force, reason := r.config.ForceFor(md.Name, md.Version)
+			if !force {
+				skipped = append(skipped, newSkippedChart(chartPath, md, reason))
+				continue
+			}
+			r.log.Warn(fmt.Sprintf("chart %s %s is already released, force is set, release asset and index entry will be replaced", md.Name, md.Version))
+		}
+		changed = append(changed, SourceChart{Name: md.Name, Version: md.Version, Path: chartPath})
+	}
+
+	for _, s := range skipped {
+		r.log.Info(fmt.Sprintf("skipping chart %s %s at %s: %s", s.Name, s.Version, s.Path, s.Reason))
+	}
+	return changed, skipped, nil
+}
+
+func newSkippedChart(chartPath string, md *chart.Metadata, reason string) SkippedChart {
+	return SkippedChart{SourceChart: SourceChart{Name: md.Name, Version: md.Version, Path: chartPath}, Reason: reason}
+}
+
+// newSourceChart returns source chart of the packaged chart, packaged chart path is used if the source is unknown
+func newSourceChart(ch helm.Chart) SourceChart {
+	path := ch.SourcePath
+	if path == "" {
+		path = ch.Path
+	}
+	return SourceChart{Name: ch.Name(), Version: ch.Metadata.Version, Path: path}
+}
+
+func newFailedChart(ch helm.Chart, err error) FailedChart {
+	return FailedChart{SourceChart: newSourceChart(ch), Reason: err.Error()}
+}
+
+// failedError returns error with all the failed charts, or nil if no chart failed
+func failedError(failed []FailedChart) error {
+	var errs []error
+	for _, f := range failed {
+		errs = append(errs, fmt.Errorf("chart %s %s: %s", f.Name, f.Version, f.Reason))
+	}
+	return errors.Join(errs...)
+}
+
+// containsPathFile checks whether any of the supplied files is located in the path directory (or its subdirectories),
+// path and files have to be both either absolute or relative to the same directory
+func containsPathFile(path string, files []string) bool {
+	for _, file := range files {
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// absPath returns absolute path with resolved symlinks (git returns resolved repository path), path is returned
+// unchanged if it cannot be resolved
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
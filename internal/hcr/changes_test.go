@@ -0,0 +1,99 @@
+package hcr
+
+import (
+	"github.com/pete911/hcr/internal/git"
+	"github.com/pete911/hcr/internal/helm"
+	"go.uber.org/zap"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangedChartsSinceWithAbsoluteChartsDir(t *testing.T) {
+	repoDir := t.TempDir()
+	gitRun(t, repoDir, "init", "-q")
+	writeChart(t, filepath.Join(repoDir, "charts", "a"), "a", "1.0.0")
+	writeChart(t, filepath.Join(repoDir, "charts", "b"), "b", "1.0.0")
+	gitRun(t, repoDir, "add", ".")
+	gitRun(t, repoDir, "commit", "-q", "-m", "add charts")
+	writeChart(t, filepath.Join(repoDir, "charts", "a"), "a", "1.1.0")
+	gitRun(t, repoDir, "commit", "-q", "-am", "bump a")
+
+	// run outside of the repository, so paths relative to the working dir cannot match
+	chdir(t, t.TempDir())
+
+	log := zap.NewNop()
+	r := Releaser{
+		gitClient:  git.NewClient(log),
+		helmClient: helm.NewClient(log, helm.Config{}),
+		config:     Config{ChartsDir: filepath.Join(repoDir, "charts"), Since: "HEAD~1"},
+		log:        log,
+	}
+	notReleased := func(name, version string) (bool, error) { return false, nil }
+	changed, skipped, err := r.changedCharts(notReleased)
+	if err != nil {
+		t.Fatalf("changed charts: %v", err)
+	}
+	if len(changed) != 1 || changed[0].Name != "a" || changed[0].Version != "1.1.0" {
+		t.Errorf("expected changed chart a 1.1.0, got %+v", changed)
+	}
+	if len(skipped) != 1 || skipped[0].Name != "b" {
+		t.Errorf("expected skipped chart b, got %+v", skipped)
+	}
+}
+
+func TestContainsPathFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		files    []string
+		expected bool
+	}{
+		{name: "absolute file in path", path: "/repo/charts/a", files: []string{"/repo/charts/a/Chart.yaml"}, expected: true},
+		{name: "absolute file in subdirectory", path: "/repo/charts/a", files: []string{"/repo/charts/a/templates/cm.yaml"}, expected: true},
+		{name: "chart name prefix of other chart", path: "/repo/charts/a", files: []string{"/repo/charts/ab/Chart.yaml"}, expected: false},
+		{name: "file outside of path", path: "/repo/charts/a", files: []string{"/repo/README.md"}, expected: false},
+		{name: "relative file in current dir", path: ".", files: []string{"Chart.yaml"}, expected: true},
+		{name: "no files", path: "/repo/charts/a", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := containsPathFile(tt.path, tt.files); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %s: %v", args, b, err)
+	}
+}
+
+func writeChart(t *testing.T, dir, name, version string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chartYaml := "apiVersion: v2\nname: " + name + "\nversion: " + version + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartYaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -0,0 +1,37 @@
+package hcr
+
+import (
+	"fmt"
+	"github.com/pete911/hcr/internal/helm"
+)
+
+// uploadToChartMuseum uploads packaged chart to ChartMuseum and returns the chart url, empty url is returned if the dry
+// run is set to true. Chart version that is already in ChartMuseum is replaced only if force is set for the chart.
+func (r Releaser) uploadToChartMuseum(ch helm.Chart) (string, error) {
+	if r.config.DryRun {
+		r.log.Info(fmt.Sprintf("chart %s %s upload to %s skipping, dry run is set to true", ch.Name(), ch.Metadata.Version, r.config.ChartMuseum.Url))
+		return "", nil
+	}
+	force, _ := r.config.ForceFor(ch.Name(), ch.Metadata.Version)
+	uploaded, err := r.chartMuseumClient.Upload(ch.Name(), ch.Metadata.Version, ch.Path, ch.ProvenancePath, force)
+	if err != nil {
+		return "", err
+	}
+	return uploaded.Url, nil
+}
+
+// releaseChartToChartMuseum uploads chart to ChartMuseum (and pushes it to OCI registry if it is set), there is no
+// release and GitHub pages index, ChartMuseum maintains its own index
+func (r Releaser) releaseChartToChartMuseum(ch helm.Chart) (ReleasedChart, error) {
+	chartMuseumUrl, err := r.uploadToChartMuseum(ch)
+	if err != nil {
+		return ReleasedChart{}, err
+	}
+	var ref string
+	if r.config.OCI.Enabled() {
+		if ref, err = r.pushChart(ch); err != nil {
+			return ReleasedChart{}, err
+		}
+	}
+	return ReleasedChart{Chart: ch, ChartMuseumUrl: chartMuseumUrl, OciRef: ref}, nil
+}
@@ -2,23 +2,113 @@ package hcr
 
 import (
 	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/pete911/hcr/internal/chartmuseum"
 	"github.com/pete911/hcr/internal/helm"
+	"github.com/pete911/hcr/internal/oci"
+	"github.com/pete911/hcr/internal/s3"
 	"github.com/pete911/hcr/internal/utils"
+	"time"
 )
 
 type Config struct {
 	PagesBranch string
 	ChartsDir   string
+	Since       string
 	HelmConfig  helm.Config
+	Lint        bool
+	LintStrict  bool
+	Concurrency int
 	PreRelease  bool
 	Tag         string
+	// Force re-releases already released pre-release versions, ForceStable allows to re-release any version
+	Force       bool
+	ForceStable bool
 	Remote      string
-	Token       string
-	DryRun      bool
-	Version     bool
+	// Backend is git hosting service charts are released to (auto, github, gitlab or gitea), ApiUrl overrides its api
+	// url (GitHub Enterprise Server, self-hosted GitLab or Gitea)
+	Backend string
+	ApiUrl  string
+	Token   string
+	Retry   utils.Retry
+	DryRun  bool
+	Version bool
+	// Page renders index.html landing page to GitHub pages, PageTemplate overrides the default page template
+	Page         bool
+	PageTemplate string
+	// PagesUrl is GitHub pages url, it defaults to https://<owner>.github.io/<repo>
+	PagesUrl    string
+	ArtifactHub ArtifactHubConfig
+	// OCI is registry charts are pushed to in addition to GitHub releases, or instead of GitHub releases and GitHub
+	// pages index if OCIOnly is set
+	OCI     oci.Config
+	OCIOnly bool
+	// ChartMuseum is server charts are uploaded to in addition to GitHub releases (or S3 bucket), or instead of GitHub
+	// releases and GitHub pages index if ChartMuseumOnly is set
+	ChartMuseum     chartmuseum.Config
+	ChartMuseumOnly bool
+	// S3 is bucket charts and index are uploaded to instead of GitHub releases and GitHub pages
+	S3 s3.Config
+	// DeletePrunedReleases deletes GitHub releases (assets) of chart versions removed from the index by retention policy
+	DeletePrunedReleases bool
+	// ReportFile is path of the report file, report is printed to stdout if it is empty
+	ReportFile   string
+	ReportFormat string
+	// Reproducible uses SourceDateEpoch (or chart last commit time if it is zero) instead of the current time for chart
+	// archives files modification time and index entries created time
+	Reproducible    bool
+	SourceDateEpoch time.Time
+	// Yank is chart version withdrawn by yank command
+	Yank YankConfig
+	// Export is directory or tarball charts and index are written to by export command
+	Export ExportConfig
+	// PackagedCharts are paths of already packaged charts (index command)
+	PackagedCharts []string
+	// Charts are per chart overrides, key is chart name
+	Charts map[string]ChartConfig
+}
+
+// ChartConfig overrides global config for a specific chart
+type ChartConfig struct {
+	// Tag is release tag template e.g. '{{ .Name }}-{{ .Version }}'
+	Tag        string
+	PreRelease *bool
+	// Description replaces generated release notes
+	Description string
+	// ExtraAssets are paths of files uploaded to the release together with the chart
+	ExtraAssets []string
+	// ValuesFiles are paths (relative to the chart directory) of extra values files chart is validated with
+	ValuesFiles []string
+	Skip        bool
+	Force       bool
+	ForceStable bool
+}
+
+// PreReleaseFor returns whether the chart release should be marked as pre-release
+func (c Config) PreReleaseFor(name string) bool {
+	if preRelease := c.Charts[name].PreRelease; preRelease != nil {
+		return *preRelease
+	}
+	return c.PreRelease
+}
+
+// ForceFor returns whether already released chart version should be released again, reason is returned if it should
+// not
+func (c Config) ForceFor(name, version string) (bool, string) {
+	if !c.Force && !c.Charts[name].Force {
+		return false, "version already released"
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, fmt.Sprintf("version already released, force: %v", err)
+	}
+	if v.Prerelease() == "" && !c.ForceStable && !c.Charts[name].ForceStable {
+		return false, "version already released, force of not pre-release version requires force-stable"
+	}
+	return true, ""
 }
 
 func (c Config) String() string {
-	return fmt.Sprintf("pages-branch: %q, charts-dir: %q, pre-release: %t, tag: %q, remote: %q, token: %s, dry-run: %t, helm-config: %s",
-		c.PagesBranch, c.ChartsDir, c.PreRelease, c.Tag, c.Remote, utils.SecretValue(c.Token), c.DryRun, c.HelmConfig)
+	return fmt.Sprintf("pages-branch: %q, charts-dir: %q, since: %q, lint: %t, lint-strict: %t, concurrency: %d, pre-release: %t, tag: %q, force: %t, force-stable: %t, remote: %q, backend: %q, api-url: %q, token: %s, retry: %s, dry-run: %t, page: %t, page-template: %q, pages-url: %q, artifacthub-repository-id: %q, artifacthub-changes: %t, delete-pruned-releases: %t, report-file: %q, report-format: %q, oci: {%s}, oci-only: %t, chartmuseum: {%s}, chartmuseum-only: %t, s3: {%s}, reproducible: %t, source-date-epoch: %s, yank: {%s}, export: {%s}, charts: %d, helm-config: %s",
+		c.PagesBranch, c.ChartsDir, c.Since, c.Lint, c.LintStrict, c.Concurrency, c.PreRelease, c.Tag, c.Force, c.ForceStable, c.Remote, c.Backend, c.ApiUrl, utils.SecretValue(c.Token), c.Retry, c.DryRun, c.Page, c.PageTemplate, c.PagesUrl, c.ArtifactHub.RepositoryId, c.ArtifactHub.Changes, c.DeletePrunedReleases, c.ReportFile, c.ReportFormat, c.OCI, c.OCIOnly, c.ChartMuseum, c.ChartMuseumOnly, c.S3, c.Reproducible, c.SourceDateEpoch, c.Yank, c.Export, len(c.Charts), c.HelmConfig)
 }
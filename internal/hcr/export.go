@@ -0,0 +1,261 @@
+package hcr
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/helm"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportConfig is local directory (or tarball) self-contained helm repository is exported to by export command
+type ExportConfig struct {
+	// Out is directory, or tarball if it ends with .tgz or .tar.gz
+	Out string
+	// BaseUrl is url the exported repository is served on, chart urls in the index are relative if it is empty
+	BaseUrl string
+}
+
+func (e ExportConfig) String() string {
+	return fmt.Sprintf("out: %q, base-url: %q", e.Out, e.BaseUrl)
+}
+
+// Enabled returns true if the releaser is used by export command
+func (e ExportConfig) Enabled() bool {
+	return e.Out != ""
+}
+
+// Tarball returns true if the repository is exported to tarball instead of directory
+func (e ExportConfig) Tarball() bool {
+	return strings.HasSuffix(e.Out, ".tgz") || strings.HasSuffix(e.Out, ".tar.gz")
+}
+
+// ChartUrl returns url of the exported chart used in the index
+func (e ExportConfig) ChartUrl(fileName string) string {
+	if e.BaseUrl == "" {
+		return fileName
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(e.BaseUrl, "/"), fileName)
+}
+
+// ExportedChart is packaged chart copied to the export directory, Path is the exported chart path
+type ExportedChart struct {
+	helm.Chart
+	AssetUrl string
+}
+
+// Export packages all the charts and writes them (with provenance files) and index file to the export directory or
+// tarball, git remote and GitHub are not used. Index file already in the export directory is updated, so charts
+// exported by previous runs are kept.
+func (r Releaser) Export() (Result, error) {
+	// gh-pages tmp dir is not used as a worktree by export, it has to be removed in every mode
+	defer os.RemoveAll(r.ghPagesDir)
+	dir := r.config.Export.Out
+	if r.config.Export.Tarball() {
+		// tarball is created from the tmp dir
+		dir = r.ghPagesDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Result{}, fmt.Errorf("create export dir: %w", err)
+	}
+	indexFilePath := filepath.Join(dir, indexFileName)
+	indexFile, err := r.helmClient.LoadIndexFile(indexFilePath)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// charts are packaged to tmp dir, export dir can be the current working directory
+	packageDir, err := os.MkdirTemp("", "hcr-export")
+	if err != nil {
+		return Result{}, fmt.Errorf("create package tmp dir: %w", err)
+	}
+	defer os.RemoveAll(packageDir)
+
+	// all the charts are exported, not only the ones missing in the index
+	notReleased := func(string, string) (bool, error) { return false, nil }
+	charts, result, chartsCleanup, err := r.packageChangedCharts(indexFile, notReleased, packageDir)
+	if err != nil {
+		return result, err
+	}
+	defer chartsCleanup()
+	if len(charts) == 0 {
+		r.log.Info("no charts to export")
+		return result, failedError(result.Failed)
+	}
+
+	var files []string
+	var pruned []helm.PrunedVersion
+	for _, ch := range charts {
+		exported, err := r.exportChart(dir, ch)
+		if err != nil {
+			return result, err
+		}
+		_, chartPruned, err := r.helmClient.AddToIndex(indexFile, ch, exported.AssetUrl, indexFile.Has(ch.Name(), ch.Metadata.Version))
+		if err != nil {
+			return result, fmt.Errorf("chart %s %s update index: %w", ch.Name(), ch.Metadata.Version, err)
+		}
+		pruned = append(pruned, chartPruned...)
+		files = append(files, filepath.Base(exported.Path))
+		if exported.ProvenancePath != "" {
+			files = append(files, filepath.Base(exported.ProvenancePath))
+		}
+		result.Exported = append(result.Exported, exported)
+	}
+	// files of the chart versions removed from the index by retention policy are removed from the export as well
+	prunedFiles, err := r.deletePrunedFiles(dir, pruned)
+	if err != nil {
+		return result, err
+	}
+	result.Pruned = newPrunedCharts(pruned)
+	files = append(removeFiles(files, prunedFiles), indexFileName)
+	result.Exported = removeExported(result.Exported, prunedFiles)
+	if err := r.helmClient.WriteIndexFile(indexFile, indexFilePath); err != nil {
+		return result, fmt.Errorf("write index: %w", err)
+	}
+
+	if r.config.Export.Tarball() {
+		if err := r.writeExportTarball(dir, files); err != nil {
+			return result, err
+		}
+	}
+	r.log.Info(fmt.Sprintf("exported %d charts to %s", len(charts), r.config.Export.Out))
+	return result, failedError(result.Failed)
+}
+
+// exportChart copies packaged chart and its provenance file to the export directory
+func (r Releaser) exportChart(dir string, ch helm.Chart) (ExportedChart, error) {
+	fileName := filepath.Base(ch.Path)
+	exported := ExportedChart{Chart: ch, AssetUrl: r.config.Export.ChartUrl(fileName)}
+	exported.Path = filepath.Join(dir, fileName)
+	if err := copyFile(ch.Path, exported.Path); err != nil {
+		return ExportedChart{}, fmt.Errorf("export chart %s: %w", fileName, err)
+	}
+	if ch.ProvenancePath != "" {
+		// helm looks for provenance file at the chart url with .prov suffix
+		exported.ProvenancePath = exported.Path + ".prov"
+		if err := copyFile(ch.ProvenancePath, exported.ProvenancePath); err != nil {
+			return ExportedChart{}, fmt.Errorf("export chart %s provenance file: %w", fileName, err)
+		}
+	}
+	r.log.Info(fmt.Sprintf("chart %s %s exported to %s", ch.Name(), ch.Metadata.Version, exported.Path))
+	return exported, nil
+}
+
+// deletePrunedFiles deletes exported charts (and provenance files) of the pruned chart versions from the export
+// directory and returns names of the deleted files, only charts with urls pointing to the export are deleted
+func (r Releaser) deletePrunedFiles(dir string, pruned []helm.PrunedVersion) ([]string, error) {
+	var deleted []string
+	var errs []error
+	for _, p := range pruned {
+		for _, url := range p.Urls {
+			fileName := path.Base(url)
+			if url != r.config.Export.ChartUrl(fileName) {
+				r.log.Warn(fmt.Sprintf("chart %s %s url %s is not in the export, skipping delete", p.Name, p.Version, url))
+				continue
+			}
+			for _, name := range []string{fileName, fileName + ".prov"} {
+				err := os.Remove(filepath.Join(dir, name))
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, fmt.Errorf("chart %s %s: delete pruned file: %w", p.Name, p.Version, err))
+					continue
+				}
+				deleted = append(deleted, name)
+			}
+			r.log.Info(fmt.Sprintf("chart %s %s deleted from %s", p.Name, p.Version, dir))
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// removeFiles returns files without the removed files
+func removeFiles(files, removed []string) []string {
+	var kept []string
+	for _, file := range files {
+		if !slices.Contains(removed, file) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// removeExported returns exported charts without the charts with removed files
+func removeExported(exported []ExportedChart, removed []string) []ExportedChart {
+	var kept []ExportedChart
+	for _, ch := range exported {
+		if !slices.Contains(removed, filepath.Base(ch.Path)) {
+			kept = append(kept, ch)
+		}
+	}
+	return kept
+}
+
+// writeExportTarball writes files from the dir to the export tarball, files are sorted and (in reproducible mode) have
+// the same modification time, so the same charts always produce the same tarball
+func (r Releaser) writeExportTarball(dir string, files []string) (err error) {
+	modTime, err := r.modTime("")
+	if err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	sort.Strings(files)
+
+	f, err := os.Create(r.config.Export.Out)
+	if err != nil {
+		return fmt.Errorf("create export tarball: %w", err)
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		if err := addTarFile(tw, filepath.Join(dir, file), file, modTime); err != nil {
+			return fmt.Errorf("export tarball: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("export tarball: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("export tarball: %w", err)
+	}
+	return nil
+}
+
+func addTarFile(tw *tar.Writer, path, name string, modTime time.Time) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("%s header: %w", name, err)
+	}
+	if _, err := tw.Write(b); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, out.Close()) }()
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,80 @@
+package hcr
+
+import (
+	"github.com/pete911/hcr/internal/helm"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExportToCurrentDir(t *testing.T) {
+	dir := t.TempDir()
+	writeChart(t, filepath.Join(dir, "charts", "app"), "app", "0.1.0")
+	// export dir is the current working directory charts are packaged to by the other commands
+	chdir(t, dir)
+	log := zap.NewNop()
+	r := Releaser{
+		helmClient: helm.NewClient(log, helm.Config{Dependency: helm.DependencyNone}),
+		config:     Config{ChartsDir: "charts", Concurrency: 1, Export: ExportConfig{Out: "."}},
+		log:        log,
+	}
+
+	result, err := r.Export()
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(result.Exported) != 1 {
+		t.Fatalf("expected 1 exported chart, got %d", len(result.Exported))
+	}
+	ch, err := loader.LoadFile(filepath.Join(dir, "app-0.1.0.tgz"))
+	if err != nil {
+		t.Fatalf("load exported chart: %v", err)
+	}
+	if ch.Name() != "app" || ch.Metadata.Version != "0.1.0" {
+		t.Errorf("unexpected exported chart %s %s", ch.Name(), ch.Metadata.Version)
+	}
+	if _, err := os.Stat(filepath.Join(dir, indexFileName)); err != nil {
+		t.Errorf("expected index file to be exported: %v", err)
+	}
+}
+
+func TestDeletePrunedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app-0.1.0.tgz", "app-0.1.0.tgz.prov", "app-0.2.0.tgz", "other-0.1.0.tgz"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+	r := Releaser{config: Config{Export: ExportConfig{Out: dir, BaseUrl: "https://example.com/charts"}}, log: zap.NewNop()}
+
+	pruned := []helm.PrunedVersion{
+		{Name: "app", Version: "0.1.0", Urls: []string{"https://example.com/charts/app-0.1.0.tgz"}},
+		// url not in the export is not deleted
+		{Name: "other", Version: "0.1.0", Urls: []string{"https://other.com/other-0.1.0.tgz"}},
+	}
+	deleted, err := r.deletePrunedFiles(dir, pruned)
+	if err != nil {
+		t.Fatalf("delete pruned files: %v", err)
+	}
+	if expected := []string{"app-0.1.0.tgz", "app-0.1.0.tgz.prov"}; !slices.Equal(deleted, expected) {
+		t.Errorf("expected deleted files %v, got %v", expected, deleted)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, e := range entries {
+		actual = append(actual, e.Name())
+	}
+	if expected := []string{"app-0.2.0.tgz", "other-0.1.0.tgz"}; !slices.Equal(actual, expected) {
+		t.Errorf("expected export dir files %v, got %v", expected, actual)
+	}
+
+	files := removeFiles([]string{"app-0.1.0.tgz", "app-0.1.0.tgz.prov", "app-0.2.0.tgz"}, deleted)
+	if expected := []string{"app-0.2.0.tgz"}; !slices.Equal(files, expected) {
+		t.Errorf("expected tarball files %v, got %v", expected, files)
+	}
+}
@@ -0,0 +1,45 @@
+package hcr
+
+import (
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/git"
+	"github.com/pete911/hcr/internal/gitea"
+	"github.com/pete911/hcr/internal/github"
+	"github.com/pete911/hcr/internal/gitlab"
+	"go.uber.org/zap"
+)
+
+// newForgeClient returns release client of the configured backend, auto backend is detected from the remote url host
+// (GitHub if the remote url is not known)
+func newForgeClient(log *zap.Logger, config Config, remoteUrl git.RemoteUrl, remoteUrlErr error) (forge.Client, error) {
+	backend := config.Backend
+	if backend == "" || backend == forge.Auto {
+		backend = forge.DetectBackend(remoteUrl.Hostname())
+	}
+
+	switch backend {
+	case forge.GitLab:
+		apiUrl := config.ApiUrl
+		if apiUrl == "" {
+			if remoteUrlErr != nil {
+				return nil, fmt.Errorf("gitlab api url is not set and cannot be derived from the remote: %w", remoteUrlErr)
+			}
+			apiUrl = gitlab.DefaultApiUrl(remoteUrl.WebUrl())
+		}
+		log.Info(fmt.Sprintf("using gitlab backend, api url %s", apiUrl))
+		return gitlab.NewClient(log, config.Token, apiUrl, config.Retry)
+	case forge.Gitea:
+		apiUrl := config.ApiUrl
+		if apiUrl == "" {
+			if remoteUrlErr != nil {
+				return nil, fmt.Errorf("gitea api url is not set and cannot be derived from the remote: %w", remoteUrlErr)
+			}
+			apiUrl = gitea.DefaultApiUrl(remoteUrl.WebUrl())
+		}
+		log.Info(fmt.Sprintf("using gitea backend, api url %s", apiUrl))
+		return gitea.NewClient(log, config.Token, apiUrl, config.Retry)
+	default:
+		return github.NewClient(log, config.Token, config.ApiUrl, config.Retry)
+	}
+}
@@ -0,0 +1,150 @@
+package hcr
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/pete911/hcr/internal/git"
+	"github.com/pete911/hcr/internal/helm"
+	"helm.sh/helm/v3/pkg/repo"
+	"regexp"
+	"strings"
+)
+
+// conventional commit subject e.g. 'feat(chart)!: add ingress'
+var conventionalCommitRegex = regexp.MustCompile(`^(\w+)(\([^)]*\))?!?:\s*(.+)$`)
+
+// commitGroups are conventional commit types with release notes headings, in the order they are printed
+var commitGroups = []struct {
+	commitType string
+	heading    string
+}{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"refactor", "Code Refactoring"},
+	{"docs", "Documentation"},
+	{"build", "Build System"},
+	{"ci", "Continuous Integration"},
+	{"test", "Tests"},
+	{"chore", "Chores"},
+}
+
+func defaultReleaseNotes(ch helm.Chart) string {
+	return fmt.Sprintf("Kubernetes %s Helm chart", ch.Name())
+}
+
+// releaseNotes returns release notes generated from git commits that changed the chart directory since the previous
+// released chart version. If the history is not available, default release notes are returned.
+func (r Releaser) releaseNotes(indexFile *repo.IndexFile, ch helm.Chart) string {
+	commits, err := r.chartCommits(indexFile, SourceChart{Name: ch.Name(), Version: ch.Metadata.Version, Path: ch.SourcePath})
+	if err != nil {
+		r.log.Warn(fmt.Sprintf("chart %s %s release notes: %v, using default release notes", ch.Name(), ch.Metadata.Version, err))
+		return defaultReleaseNotes(ch)
+	}
+	if len(commits) == 0 {
+		return defaultReleaseNotes(ch)
+	}
+	return formatReleaseNotes(ch, commits)
+}
+
+// chartCommits returns commits that changed chart source directory since the previous version in the index
+func (r Releaser) chartCommits(indexFile *repo.IndexFile, ch SourceChart) ([]git.Commit, error) {
+	if ch.Path == "" {
+		return nil, fmt.Errorf("chart source path is unknown")
+	}
+	shallow, err := r.gitClient.IsShallow()
+	if err != nil {
+		return nil, err
+	}
+	if shallow {
+		return nil, fmt.Errorf("git history is not available in shallow clone")
+	}
+
+	previousVersion, err := previousVersion(indexFile, ch)
+	if err != nil {
+		return nil, err
+	}
+	// first released version, use the whole chart history
+	if previousVersion == "" {
+		return r.gitClient.Log(ch.Path, "")
+	}
+	// tag is the same for all the versions, we cannot find the previous version tag
+	previousTag, err := r.releaseTag(ch.Name, previousVersion)
+	if err != nil {
+		return nil, err
+	}
+	currentTag, err := r.releaseTag(ch.Name, ch.Version)
+	if err != nil {
+		return nil, err
+	}
+	if previousTag == currentTag {
+		return nil, fmt.Errorf("previous version %s tag is unknown, release tag %s does not contain version", previousVersion, previousTag)
+	}
+
+	previousTag, err = r.gitClient.Describe(previousTag)
+	if err != nil {
+		return nil, fmt.Errorf("previous version %s tag: %w", previousVersion, err)
+	}
+	return r.gitClient.Log(ch.Path, previousTag)
+}
+
+// previousVersion returns the highest version of the chart in the index that is lower than the released version, if
+// there is no such version, empty string is returned
+func previousVersion(indexFile *repo.IndexFile, ch SourceChart) (string, error) {
+	current, err := semver.NewVersion(ch.Version)
+	if err != nil {
+		return "", fmt.Errorf("parse chart version: %w", err)
+	}
+
+	var previous *semver.Version
+	var previousVersion string
+	for _, chartVersion := range indexFile.Entries[ch.Name] {
+		v, err := semver.NewVersion(chartVersion.Version)
+		if err != nil || !v.LessThan(current) {
+			continue
+		}
+		if previous == nil || v.GreaterThan(previous) {
+			previous = v
+			previousVersion = chartVersion.Version
+		}
+	}
+	return previousVersion, nil
+}
+
+// formatReleaseNotes returns markdown release notes, commits are grouped by conventional commit type, commits that do
+// not follow conventional commits are listed under 'Other Changes'
+func formatReleaseNotes(ch helm.Chart, commits []git.Commit) string {
+	grouped := make(map[string][]string)
+	var other []string
+	for _, commit := range commits {
+		match := conventionalCommitRegex.FindStringSubmatch(commit.Subject)
+		if match != nil && isCommitGroup(match[1]) {
+			commitType := strings.ToLower(match[1])
+			grouped[commitType] = append(grouped[commitType], fmt.Sprintf("- %s (%s)", match[3], commit.Hash))
+			continue
+		}
+		other = append(other, fmt.Sprintf("- %s (%s)", commit.Subject, commit.Hash))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(defaultReleaseNotes(ch))
+	sb.WriteString("\n")
+	for _, group := range commitGroups {
+		if lines, ok := grouped[group.commitType]; ok {
+			sb.WriteString(fmt.Sprintf("\n## %s\n%s\n", group.heading, strings.Join(lines, "\n")))
+		}
+	}
+	if len(other) > 0 {
+		sb.WriteString(fmt.Sprintf("\n## Other Changes\n%s\n", strings.Join(other, "\n")))
+	}
+	return sb.String()
+}
+
+func isCommitGroup(commitType string) bool {
+	for _, group := range commitGroups {
+		if strings.EqualFold(group.commitType, commitType) {
+			return true
+		}
+	}
+	return false
+}
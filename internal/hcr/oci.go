@@ -0,0 +1,20 @@
+package hcr
+
+import (
+	"fmt"
+	"github.com/pete911/hcr/internal/helm"
+)
+
+// pushChart pushes packaged chart to OCI registry and returns the chart reference, empty reference is returned if
+// the dry run is set to true
+func (r Releaser) pushChart(ch helm.Chart) (string, error) {
+	if r.config.DryRun {
+		r.log.Info(fmt.Sprintf("chart %s %s push to %s skipping, dry run is set to true", ch.Name(), ch.Metadata.Version, r.config.OCI.Registry))
+		return "", nil
+	}
+	pushed, err := r.ociClient.Push(ch.Name(), ch.Metadata.Version, ch.Path, ch.ProvenancePath, ch.ModTime)
+	if err != nil {
+		return "", err
+	}
+	return pushed.Ref, nil
+}
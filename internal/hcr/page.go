@@ -0,0 +1,141 @@
+package hcr
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pageFileName is GitHub pages landing page, it is committed together with the index file
+const pageFileName = "index.html"
+
+//go:embed templates/index.html.tmpl
+var defaultPageTemplate string
+
+type pageData struct {
+	// Name is helm repository name used in 'helm repo add' command
+	Name      string
+	Url       string
+	Charts    []pageChart
+	Generated time.Time
+}
+
+// pageChart is chart with the latest version metadata and all the versions
+type pageChart struct {
+	Name        string
+	Version     string
+	AppVersion  string
+	Description string
+	Icon        string
+	Versions    []pageChartVersion
+}
+
+type pageChartVersion struct {
+	Version    string
+	AppVersion string
+	Created    time.Time
+	Url        string
+}
+
+// writePage renders landing page from the GitHub pages index file to the GitHub pages worktree
+func (r Releaser) writePage() error {
+	t, err := r.pageTemplate()
+	if err != nil {
+		return err
+	}
+	data, err := r.pageData()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(r.ghPagesDir, pageFileName))
+	if err != nil {
+		return fmt.Errorf("create %s: %w", pageFileName, err)
+	}
+	defer f.Close()
+	if err := t.Execute(f, data); err != nil {
+		return fmt.Errorf("render %s: %w", pageFileName, err)
+	}
+	r.log.Info(fmt.Sprintf("rendered %s with %d charts", pageFileName, len(data.Charts)))
+	return nil
+}
+
+func (r Releaser) pageTemplate() (*template.Template, error) {
+	if r.config.PageTemplate == "" {
+		return template.New(pageFileName).Parse(defaultPageTemplate)
+	}
+	b, err := os.ReadFile(r.config.PageTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("read page template: %w", err)
+	}
+	t, err := template.New(filepath.Base(r.config.PageTemplate)).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("parse page template: %w", err)
+	}
+	return t, nil
+}
+
+func (r Releaser) pageData() (pageData, error) {
+	indexFile, err := r.helmClient.LoadIndexFile(r.ghPagesIndexPath)
+	if err != nil {
+		return pageData{}, err
+	}
+	name, url, err := r.pagesUrl()
+	if err != nil {
+		return pageData{}, err
+	}
+
+	data := pageData{Name: name, Url: url, Generated: indexFile.Generated}
+	// index entries are sorted, the latest version is the first one
+	indexFile.SortEntries()
+	for _, chartName := range sortedKeys(indexFile.Entries) {
+		chartVersions := indexFile.Entries[chartName]
+		if len(chartVersions) == 0 {
+			continue
+		}
+		latest := chartVersions[0]
+		ch := pageChart{
+			Name:        chartName,
+			Version:     latest.Version,
+			AppVersion:  latest.AppVersion,
+			Description: latest.Description,
+			Icon:        latest.Icon,
+		}
+		for _, cv := range chartVersions {
+			var url string
+			if len(cv.URLs) > 0 {
+				url = cv.URLs[0]
+			}
+			ch.Versions = append(ch.Versions, pageChartVersion{Version: cv.Version, AppVersion: cv.AppVersion, Created: cv.Created, Url: url})
+		}
+		data.Charts = append(data.Charts, ch)
+	}
+	return data, nil
+}
+
+// pagesUrl returns helm repository name and pages url, if the pages url is not set, it is derived from the owner and
+// repository by the backend client
+func (r Releaser) pagesUrl() (string, string, error) {
+	if r.config.PagesUrl != "" {
+		url := strings.TrimSuffix(r.config.PagesUrl, "/")
+		return path.Base(url), url, nil
+	}
+	if r.config.S3.PublicUrl != "" {
+		url := strings.TrimSuffix(r.config.S3.PublicUrl, "/")
+		return path.Base(url), url, nil
+	}
+	owner, repo, err := r.ownerAndRepo()
+	if err != nil {
+		return "", "", err
+	}
+	url, err := r.forgeClient.PagesUrl(owner, repo)
+	if err != nil {
+		return "", "", err
+	}
+	return repo, url, nil
+}
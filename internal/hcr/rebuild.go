@@ -0,0 +1,161 @@
+package hcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/helm"
+	"github.com/pete911/hcr/internal/utils"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RebuildIndex downloads charts from all the GitHub releases and replaces GitHub pages index with the new index
+// containing all the downloaded charts. Created timestamps of charts already in the index are preserved.
+func (r Releaser) RebuildIndex(ctx context.Context) (Result, error) {
+	if r.config.S3.Enabled() {
+		return Result{}, errors.New("index rebuild is not supported with s3 bucket, charts are not uploaded to releases")
+	}
+	return r.withPagesWorktree(func() (Result, error) {
+		owner, repo, err := r.ownerAndRepo()
+		if err != nil {
+			return Result{}, err
+		}
+
+		assets, err := r.forgeClient.ListReleaseAssets(ctx, owner, repo)
+		if err != nil {
+			return Result{}, err
+		}
+		downloadDir, err := os.MkdirTemp("", "hcr-assets")
+		if err != nil {
+			return Result{}, fmt.Errorf("create assets tmp dir: %w", err)
+		}
+		defer os.RemoveAll(downloadDir)
+
+		indexCharts, result := r.downloadReleasedCharts(ctx, owner, repo, assets, downloadDir)
+		if err := failedError(result.Failed); err != nil {
+			// index is not rebuilt, it would not contain the failed charts
+			return result, err
+		}
+		if err := r.helmClient.RebuildIndex(r.ghPagesIndexPath, indexCharts); err != nil {
+			return result, fmt.Errorf("rebuild %s index file: %w", r.ghPagesIndexPath, err)
+		}
+		r.log.Info(fmt.Sprintf("index rebuilt with %d charts", len(indexCharts)))
+
+		if r.config.DryRun {
+			r.log.Info("commit and push rebuilt index skipping, dry run is set to true")
+			for _, ch := range indexCharts {
+				result.Pending = append(result.Pending, newSourceChart(ch.Chart))
+			}
+			return result, nil
+		}
+		// index is rebuilt again from the fresh index if the push is rejected, so the created timestamps are preserved
+		apply := func() (bool, error) {
+			return true, r.helmClient.RebuildIndex(r.ghPagesIndexPath, indexCharts)
+		}
+		if err := r.commitAndPushIndex(apply); err != nil {
+			return result, err
+		}
+		r.log.Info("rebuilt index pushed to github pages")
+
+		for _, ch := range indexCharts {
+			asset := assetForChart(assets, ch)
+			// downloaded chart is removed, use asset name as package path
+			released := ch.Chart
+			released.Path = asset.Name
+			result.Released = append(result.Released, ReleasedChart{
+				Chart:      released,
+				Tag:        asset.ReleaseTag,
+				ReleaseId:  asset.ReleaseId,
+				ReleaseUrl: asset.ReleaseUrl,
+				AssetUrl:   asset.Url,
+				IndexAdded: true,
+			})
+		}
+		return result, nil
+	})
+}
+
+// downloadReleasedCharts downloads packaged charts (.tgz) release assets concurrently. Assets that are not helm charts
+// are skipped and assets that failed to download are reported as failed.
+func (r Releaser) downloadReleasedCharts(ctx context.Context, owner, repo string, assets []forge.ReleaseAsset, dir string) ([]helm.IndexChart, Result) {
+	var chartAssets []forge.ReleaseAsset
+	for _, asset := range assets {
+		if strings.HasSuffix(asset.Name, ".tgz") {
+			chartAssets = append(chartAssets, asset)
+		}
+	}
+
+	charts := make([]helm.Chart, len(chartAssets))
+	errs := make([]error, len(chartAssets))
+	utils.RunConcurrently(len(chartAssets), r.config.Concurrency, func(i int) {
+		charts[i], errs[i] = r.downloadReleasedChart(ctx, owner, repo, chartAssets[i], dir)
+	})
+
+	var result Result
+	var indexCharts []helm.IndexChart
+	for i, asset := range chartAssets {
+		source := SourceChart{Name: asset.Name, Path: asset.Url}
+		if errs[i] != nil {
+			result.Failed = append(result.Failed, FailedChart{SourceChart: source, Reason: errs[i].Error()})
+			continue
+		}
+		if charts[i].Chart == nil {
+			result.Skipped = append(result.Skipped, SkippedChart{SourceChart: source, Reason: "release asset is not a helm chart"})
+			continue
+		}
+		if containsChartVersion(indexCharts, charts[i]) {
+			result.Skipped = append(result.Skipped, SkippedChart{SourceChart: source, Reason: "chart version is in another release"})
+			continue
+		}
+		indexCharts = append(indexCharts, helm.IndexChart{Chart: charts[i], Url: asset.Url, Created: asset.CreatedAt})
+	}
+	return indexCharts, result
+}
+
+// downloadReleasedChart downloads release asset to the release tag directory (assets in different releases can have
+// the same name) and loads it as a chart. Empty chart is returned if the asset is not a helm chart.
+func (r Releaser) downloadReleasedChart(ctx context.Context, owner, repo string, asset forge.ReleaseAsset, dir string) (helm.Chart, error) {
+	releaseDir := releaseAssetDir(dir, asset)
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		return helm.Chart{}, err
+	}
+	path := filepath.Join(releaseDir, asset.Name)
+	if err := r.forgeClient.DownloadAsset(ctx, owner, repo, asset, path); err != nil {
+		return helm.Chart{}, err
+	}
+
+	charts, err := r.helmClient.LoadPackagedCharts([]string{path})
+	if err != nil {
+		r.log.Warn(fmt.Sprintf("%s release asset %s: %v", asset.ReleaseTag, asset.Name, err))
+		return helm.Chart{}, nil
+	}
+	return charts[0], nil
+}
+
+// releaseAssetDir returns directory of the release assets in the dir, directory is keyed by release tag, not all the
+// backends have release id (GitLab releases are identified by tag)
+func releaseAssetDir(dir string, asset forge.ReleaseAsset) string {
+	return filepath.Join(dir, url.PathEscape(asset.ReleaseTag))
+}
+
+func assetForChart(assets []forge.ReleaseAsset, ch helm.IndexChart) forge.ReleaseAsset {
+	for _, asset := range assets {
+		if asset.Url == ch.Url {
+			return asset
+		}
+	}
+	return forge.ReleaseAsset{}
+}
+
+func containsChartVersion(charts []helm.IndexChart, ch helm.Chart) bool {
+	for _, c := range charts {
+		if c.Name() == ch.Name() && c.Metadata.Version == ch.Metadata.Version {
+			return true
+		}
+	}
+	return false
+}
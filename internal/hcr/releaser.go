@@ -2,24 +2,36 @@ package hcr
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/pete911/hcr/internal/chartmuseum"
+	"github.com/pete911/hcr/internal/forge"
 	"github.com/pete911/hcr/internal/git"
-	"github.com/pete911/hcr/internal/github"
 	"github.com/pete911/hcr/internal/helm"
+	"github.com/pete911/hcr/internal/oci"
+	"github.com/pete911/hcr/internal/s3"
+	"github.com/pete911/hcr/internal/utils"
 	"go.uber.org/zap"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Releaser struct {
-	gitClient        git.Client
-	ghClient         github.Client
-	helmClient       helm.Client
-	ghPagesDir       string
-	ghPagesIndexPath string
-	config           Config
-	log              *zap.Logger
+	gitClient         git.Client
+	forgeClient       forge.Client
+	helmClient        helm.Client
+	ociClient         oci.Client
+	chartMuseumClient chartmuseum.Client
+	s3Client          s3.Client
+	ghPagesDir        string
+	ghPagesIndexPath  string
+	remoteUrl         git.RemoteUrl
+	remoteUrlErr      error
+	config            Config
+	log               *zap.Logger
 }
 
 func NewReleaser(log *zap.Logger, config Config) (Releaser, error) {
@@ -27,122 +39,557 @@ func NewReleaser(log *zap.Logger, config Config) (Releaser, error) {
 	if err != nil {
 		return Releaser{}, fmt.Errorf("create gh-pages tmp dir: %w", err)
 	}
+	var ociClient oci.Client
+	if config.OCI.Enabled() {
+		if ociClient, err = oci.NewClient(log, config.OCI); err != nil {
+			return Releaser{}, err
+		}
+	}
+	var chartMuseumClient chartmuseum.Client
+	if config.ChartMuseum.Enabled() {
+		if chartMuseumClient, err = chartmuseum.NewClient(log, config.ChartMuseum, config.Retry); err != nil {
+			return Releaser{}, err
+		}
+	}
+	var s3Client s3.Client
+	if config.S3.Enabled() {
+		if s3Client, err = s3.NewClient(log, config.S3, config.Retry); err != nil {
+			return Releaser{}, err
+		}
+	}
+	gitClient := git.NewClient(log)
+	// commands that do not call release API work with any remote, error is returned when owner and repo are needed
+	var remoteUrl git.RemoteUrl
+	remoteUrlErr := errors.New("git remote is not used by export")
+	if !config.Export.Enabled() {
+		remoteUrl, remoteUrlErr = gitClient.GetRemoteUrl("", config.Remote)
+	}
+	forgeClient, err := newForgeClient(log, config, remoteUrl, remoteUrlErr)
+	if err != nil {
+		return Releaser{}, err
+	}
 	return Releaser{
-		gitClient:        git.NewClient(log),
-		ghClient:         github.NewClient(log, config.Token),
-		helmClient:       helm.NewClient(log, config.HelmConfig),
-		ghPagesDir:       ghPagesDir,
-		ghPagesIndexPath: filepath.Join(ghPagesDir, "index.yaml"),
-		config:           config,
-		log:              log,
+		gitClient:         gitClient,
+		forgeClient:       forgeClient,
+		helmClient:        helm.NewClient(log, config.HelmConfig),
+		ociClient:         ociClient,
+		chartMuseumClient: chartMuseumClient,
+		s3Client:          s3Client,
+		ghPagesDir:        ghPagesDir,
+		ghPagesIndexPath:  filepath.Join(ghPagesDir, "index.yaml"),
+		remoteUrl:         remoteUrl,
+		remoteUrlErr:      remoteUrlErr,
+		config:            config,
+		log:               log,
 	}, nil
 }
 
-func (r Releaser) Release(ctx context.Context) (map[string]*chart.Chart, error) {
-	// check if the remote GitHub pages branch exists
-	if err := r.pagesRemoteBranchExists(); err != nil {
-		return nil, err
+// ownerAndRepo returns owner (GitHub owner or GitLab namespace) and repo of the remote, resolved when the releaser is
+// created
+func (r Releaser) ownerAndRepo() (string, string, error) {
+	if r.remoteUrlErr != nil {
+		return "", "", fmt.Errorf("get owner and repo: %w", r.remoteUrlErr)
 	}
-	r.log.Info("github pages remote branch exists")
+	return r.remoteUrl.Owner, r.remoteUrl.Repo, nil
+}
+
+// Result contains charts packaged (package command) and released by the releaser, charts that were skipped, charts
+// that are pending release (status command and dry run) and charts that failed
+type Result struct {
+	Packaged []helm.Chart
+	Released []ReleasedChart
+	Pending  []SourceChart
+	Skipped  []SkippedChart
+	Failed   []FailedChart
+	// Yanked are chart versions removed from the index, or deprecated charts (yank command)
+	Yanked []YankedChart
+	// Verified are index entries and release assets checked by verify command
+	Verified []VerifiedChart
+	// Pruned are chart versions removed from the index by retention policy (or that would be removed, status command)
+	Pruned []PrunedChart
+	// Exported are charts written to the export directory (export command)
+	Exported []ExportedChart
+}
+
+// ReleasedChart is chart released as GitHub release, IndexAdded is false if the chart was already in the index. Forced
+// is set if the chart version was already released and its release asset and index entry were replaced. OciRef is set
+// if the chart was pushed to OCI registry and ChartMuseumUrl if the chart was uploaded to ChartMuseum.
+type ReleasedChart struct {
+	helm.Chart
+	Tag            string
+	ReleaseId      int64
+	ReleaseUrl     string
+	AssetUrl       string
+	OciRef         string
+	ChartMuseumUrl string
+	IndexAdded     bool
+	Forced         bool
+}
 
-	// package charts
-	charts, chartsCleanup, err := r.helmClient.PackageCharts(r.config.ChartsDir)
+// Release packages changed charts, creates GitHub release for every chart and updates GitHub pages index
+func (r Releaser) Release(ctx context.Context) (Result, error) {
+	return r.withIndex(func(indexFile *repo.IndexFile, released releasedFunc) (Result, error) {
+		charts, result, chartsCleanup, err := r.packageChangedCharts(indexFile, released, "")
+		if err != nil {
+			return result, err
+		}
+		defer chartsCleanup()
+
+		if len(charts) == 0 {
+			r.log.Info("no chart changes")
+			return result, failedError(result.Failed)
+		}
+		return r.publish(ctx, indexFile, charts, result)
+	})
+}
+
+// Package packages changed charts to the current directory, packaged charts are not removed
+func (r Releaser) Package() (Result, error) {
+	return r.withIndex(func(indexFile *repo.IndexFile, released releasedFunc) (Result, error) {
+		charts, result, _, err := r.packageChangedCharts(indexFile, released, "")
+		if err != nil {
+			return result, err
+		}
+		result.Packaged = charts
+		return result, failedError(result.Failed)
+	})
+}
+
+// Index creates GitHub release for every already packaged chart and updates GitHub pages index
+func (r Releaser) Index(ctx context.Context) (Result, error) {
+	charts, err := r.helmClient.LoadPackagedCharts(r.config.PackagedCharts)
+	if err != nil {
+		return Result{}, fmt.Errorf("load packaged charts: %w", err)
+	}
+	// chart source is unknown, HEAD commit time is used in reproducible mode
+	modTime, err := r.modTime("")
 	if err != nil {
-		return nil, fmt.Errorf("package charts: %w", err)
+		return Result{}, err
+	}
+	for i := range charts {
+		charts[i].ModTime = modTime
+	}
+
+	return r.withIndex(func(indexFile *repo.IndexFile, released releasedFunc) (Result, error) {
+		var result Result
+		var unreleased []helm.Chart
+		for _, ch := range charts {
+			isReleased, err := released(ch.Name(), ch.Metadata.Version)
+			if err != nil {
+				return result, err
+			}
+			if isReleased {
+				force, reason := r.config.ForceFor(ch.Name(), ch.Metadata.Version)
+				if !force {
+					result.Skipped = append(result.Skipped, SkippedChart{SourceChart: newSourceChart(ch), Reason: reason})
+					r.log.Info(fmt.Sprintf("skipping chart %s %s at %s: %s", ch.Name(), ch.Metadata.Version, ch.Path, reason))
+					continue
+				}
+				r.log.Warn(fmt.Sprintf("chart %s %s is already released, force is set, release asset and index entry will be replaced", ch.Name(), ch.Metadata.Version))
+			}
+			unreleased = append(unreleased, ch)
+		}
+		if len(unreleased) == 0 {
+			r.log.Info("no chart changes")
+			return result, nil
+		}
+		return r.publish(ctx, indexFile, unreleased, result)
+	})
+}
+
+// Status returns charts that would be released (pending), charts that would be skipped and chart versions that would
+// be removed from the index by retention policy
+func (r Releaser) Status() (Result, error) {
+	return r.withIndex(func(indexFile *repo.IndexFile, released releasedFunc) (Result, error) {
+		changed, skipped, err := r.changedCharts(released)
+		if err != nil {
+			return Result{}, err
+		}
+		// charts pushed only to OCI registry or ChartMuseum are not in the index
+		if r.config.OCIOnly || r.config.ChartMuseumOnly {
+			return Result{Pending: changed, Skipped: skipped}, nil
+		}
+		var pending []*chart.Metadata
+		for _, ch := range changed {
+			pending = append(pending, &chart.Metadata{APIVersion: chart.APIVersionV2, Name: ch.Name, Version: ch.Version})
+		}
+		pruned, err := r.helmClient.PrunedVersions(r.ghPagesIndexPath, pending)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Pending: changed, Skipped: skipped, Pruned: newPrunedCharts(pruned)}, nil
+	})
+}
+
+// releasedFunc returns true if the chart version is already released
+type releasedFunc func(name, version string) (bool, error)
+
+// withIndex calls fn with GitHub pages (or s3 bucket) index and function that checks whether the chart version is
+// already in the index. If OCI only is set, GitHub pages are not used, fn is called with empty index and chart version
+// is released if it is already pushed to the OCI registry (ChartMuseum only works the same way).
+func (r Releaser) withIndex(fn func(indexFile *repo.IndexFile, released releasedFunc) (Result, error)) (Result, error) {
+	if r.config.OCIOnly {
+		return fn(repo.NewIndexFile(), r.ociClient.Exists)
+	}
+	if r.config.ChartMuseumOnly {
+		return fn(repo.NewIndexFile(), r.chartMuseumClient.Exists)
 	}
-	defer chartsCleanup()
-	r.log.Info("charts packaged")
+	return r.withIndexStore(func() (Result, error) {
+		indexFile, err := r.helmClient.LoadIndexFile(r.ghPagesIndexPath)
+		if err != nil {
+			return Result{}, err
+		}
+		return fn(indexFile, func(name, version string) (bool, error) { return indexFile.Has(name, version), nil })
+	})
+}
 
-	// add GitHub pages worktree (so we can update index)
+// withIndexStore calls fn with the index file downloaded from s3 bucket (if s3 is set) or with GitHub pages worktree,
+// index file is at the pages index path in both cases
+func (r Releaser) withIndexStore(fn func() (Result, error)) (Result, error) {
+	if r.config.S3.Enabled() {
+		return r.withS3Index(fn)
+	}
+	return r.withPagesWorktree(fn)
+}
+
+// storeIndex uploads index file to s3 bucket (if s3 is set) or commits and pushes it to GitHub pages, apply updates
+// fresh index if the index has been modified in the meantime
+func (r Releaser) storeIndex(apply func() (bool, error)) error {
+	if r.config.S3.Enabled() {
+		return r.uploadIndex(apply)
+	}
+	return r.commitAndPushIndex(apply)
+}
+
+// withPagesWorktree checks that the GitHub pages branch exists, adds it as worktree and calls fn. Worktree is removed
+// after fn returns.
+func (r Releaser) withPagesWorktree(fn func() (Result, error)) (Result, error) {
+	// check if the remote GitHub pages branch exists
+	if err := r.pagesRemoteBranchExists(); err != nil {
+		return Result{}, err
+	}
+	r.log.Info("github pages remote branch exists")
+
+	// add GitHub pages worktree (so we can check and update index)
 	worktreeCleanup, err := r.addPagesWorktree()
 	if err != nil {
-		return nil, err
+		return Result{}, err
 	}
 	defer worktreeCleanup()
+	return fn()
+}
 
-	// release charts and update index
-	ok, err := r.releaseChartsAndUpdateIndex(ctx, charts)
+// packageChangedCharts finds charts with new versions (not released yet), packages them to the destination directory
+// (current working directory if it is empty) and (if lint is set) validates them. Returned result contains skipped
+// charts and charts that failed validation.
+func (r Releaser) packageChangedCharts(indexFile *repo.IndexFile, released releasedFunc, destination string) (charts []helm.Chart, result Result, cleanup func(), err error) {
+	changed, skipped, err := r.changedCharts(released)
 	if err != nil {
-		return nil, err
+		return nil, Result{}, nil, err
+	}
+	result.Skipped = skipped
+	if len(changed) == 0 {
+		return nil, result, func() {}, nil
+	}
+
+	var chartsPaths []string
+	annotations := r.artifactHubAnnotations(indexFile, changed)
+	options := make(map[string]helm.PackageOptions)
+	for _, ch := range changed {
+		modTime, err := r.modTime(ch.Path)
+		if err != nil {
+			return nil, result, nil, err
+		}
+		chartsPaths = append(chartsPaths, ch.Path)
+		options[ch.Path] = helm.PackageOptions{Annotations: annotations[ch.Path], ModTime: modTime, Destination: destination}
 	}
-	if !ok {
+	charts, packageFailed, cleanup := r.helmClient.PackageCharts(chartsPaths, options, r.config.Concurrency)
+	// charts that failed to package are reported, the rest of the charts is released
+	for _, ch := range changed {
+		if err, ok := packageFailed[ch.Path]; ok {
+			result.Failed = append(result.Failed, FailedChart{SourceChart: ch, Reason: err.Error()})
+		}
+	}
+	r.log.Info(fmt.Sprintf("%d charts packaged, %d charts failed", len(charts), len(packageFailed)))
+
+	// validate charts before any release is created
+	if r.config.Lint {
+		failed, err := r.validateCharts(charts)
+		if err != nil {
+			cleanup()
+			result.Failed = append(result.Failed, failed...)
+			return nil, result, nil, err
+		}
+		r.log.Info("charts validated")
+	}
+	return charts, result, cleanup, nil
+}
+
+// publish creates GitHub release for every chart, adds released charts to the supplied index (loaded from GitHub pages),
+// writes the index and pushes it to GitHub pages
+func (r Releaser) publish(ctx context.Context, indexFile *repo.IndexFile, charts []helm.Chart, result Result) (Result, error) {
+	// release charts, charts that failed to release are reported in the release error
+	released, pending, failed := r.releaseCharts(ctx, indexFile, charts)
+	// charts are pushed only to OCI registry or ChartMuseum, there is no index to update
+	if r.config.OCIOnly || r.config.ChartMuseumOnly {
+		result.Released = released
+		result.Pending = append(result.Pending, pending...)
+		result.Failed = append(result.Failed, failed...)
+		return result, failedError(result.Failed)
+	}
+	released, pruned, indexFailed := r.updateIndex(indexFile, released)
+	result.Pending = append(result.Pending, pending...)
+	result.Failed = append(result.Failed, append(failed, indexFailed...)...)
+	releaseErr := failedError(result.Failed)
+	if !indexAdded(released) {
+		result.Released = released
+		if releaseErr != nil {
+			return result, releaseErr
+		}
 		r.log.Info("no chart changes")
-		return nil, nil
+		return result, nil
 	}
 	r.log.Info("released charts and updated index")
 
-	// commit and push index
-	if err := r.gitClient.AddAndCommit(r.ghPagesDir, "index.yaml", "update index.yaml"); err != nil {
-		return nil, fmt.Errorf("git commit index to github pages: %w", err)
+	// commit and push index, released charts are added to the fresh index if the push is rejected
+	apply := func() (bool, error) {
+		freshIndexFile, err := r.helmClient.LoadIndexFile(r.ghPagesIndexPath)
+		if err != nil {
+			return false, err
+		}
+		updated, freshPruned, failed := r.updateIndex(freshIndexFile, released)
+		if err := failedError(failed); err != nil {
+			return false, err
+		}
+		if !indexAdded(updated) {
+			return false, nil
+		}
+		pruned = freshPruned
+		return true, r.helmClient.WriteIndexFile(freshIndexFile, r.ghPagesIndexPath)
 	}
-	if err := r.gitClient.Push(r.ghPagesDir, r.config.Remote, r.config.PagesBranch, r.config.Token); err != nil {
-		return nil, fmt.Errorf("git push github pages: %w", err)
+	err := r.helmClient.WriteIndexFile(indexFile, r.ghPagesIndexPath)
+	if err == nil {
+		err = r.storeIndex(apply)
 	}
+	if err != nil {
+		// charts are released, but they are not in the GitHub pages index
+		for _, ch := range released {
+			result.Failed = append(result.Failed, newFailedChart(ch.Chart, err))
+		}
+		return result, errors.Join(releaseErr, err)
+	}
+
+	r.log.Info("index updated and published")
+	result.Released = released
+	result.Pruned = newPrunedCharts(pruned)
+	switch {
+	case r.config.DeletePrunedReleases && r.config.S3.Enabled():
+		releaseErr = errors.Join(releaseErr, r.deletePrunedObjects(pruned))
+	case r.config.DeletePrunedReleases:
+		releaseErr = errors.Join(releaseErr, r.deletePrunedReleases(ctx, pruned))
+	}
+	return result, releaseErr
+}
+
+// releaseCharts releases helm charts as GitHub releases concurrently. Released charts, charts that were not released
+// because dry run is set to true (pending) and charts that failed to release are returned.
+func (r Releaser) releaseCharts(ctx context.Context, indexFile *repo.IndexFile, charts []helm.Chart) (released []ReleasedChart, pending []SourceChart, failed []FailedChart) {
+	results := make([]ReleasedChart, len(charts))
+	errs := make([]error, len(charts))
+	utils.RunConcurrently(len(charts), r.config.Concurrency, func(i int) {
+		results[i], errs[i] = r.releaseChart(ctx, indexFile, charts[i])
+	})
+
+	for i, ch := range charts {
+		if errs[i] != nil {
+			failed = append(failed, newFailedChart(ch, errs[i]))
+			continue
+		}
+		if r.config.DryRun {
+			pending = append(pending, newSourceChart(ch))
+			continue
+		}
+		released = append(released, results[i])
+	}
+	return released, pending, failed
+}
 
-	r.log.Info("index updated and pushed to github pages")
-	return charts, nil
+// updateIndex adds released charts to the index file (in memory) sequentially in the released charts order, so
+// the result is deterministic. Charts that were added to the index have IndexAdded set to true (charts already present
+// in the index do not). Chart versions removed from the index by retention policy are returned as well.
+// This method does not write, commit and push gh pages index file, only updates it.
+func (r Releaser) updateIndex(indexFile *repo.IndexFile, released []ReleasedChart) ([]ReleasedChart, []helm.PrunedVersion, []FailedChart) {
+	var updated []ReleasedChart
+	var pruned []helm.PrunedVersion
+	var failed []FailedChart
+	for _, ch := range released {
+		ok, prunedVersions, err := r.helmClient.AddToIndex(indexFile, ch.Chart, ch.AssetUrl, ch.Forced)
+		if err != nil {
+			failed = append(failed, newFailedChart(ch.Chart, fmt.Errorf("update index: %w", err)))
+			continue
+		}
+		ch.IndexAdded = ok
+		updated = append(updated, ch)
+		pruned = append(pruned, prunedVersions...)
+	}
+	return updated, pruned, failed
 }
 
-// releaseChartsAndUpdateIndex releases helm chart as GitHub releases and updates index file in GitHub pages. If the charts
-// were updated, true and nil error is returned. If there are no charts updated, false and nil error is returned.
-// This method does not commit and push gh pages index file, only updates it.
-func (r Releaser) releaseChartsAndUpdateIndex(ctx context.Context, charts map[string]*chart.Chart) (bool, error) {
-	var updated bool
-	for chPath, ch := range charts {
-		ok, err := r.releaseChartAndUpdateIndex(ctx, chPath, ch)
+// commitAndPushIndex commits and pushes index file to GitHub pages. If the push is rejected (remote branch has been
+// updated in the meantime), pages branch is fetched again, fresh index is updated by apply and push is retried. Apply
+// returns false if the fresh index does not need to be updated.
+func (r Releaser) commitAndPushIndex(apply func() (bool, error)) error {
+	backoff := r.config.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		files, err := r.writePagesFiles()
 		if err != nil {
-			return false, err
+			return err
 		}
-		if ok {
-			updated = true
+		if err := r.gitClient.AddAndCommit(r.ghPagesDir, "update index.yaml", files...); err != nil {
+			return fmt.Errorf("git commit index to github pages: %w", err)
+		}
+		err = r.gitClient.Push(r.ghPagesDir, r.config.Remote, r.config.PagesBranch, r.config.Token)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, git.ErrPushRejected) || attempt > r.config.Retry.Retries {
+			return fmt.Errorf("git push github pages: %w", err)
+		}
+
+		r.log.Warn(fmt.Sprintf("git push github pages attempt %d rejected, retrying in %s", attempt, backoff))
+		time.Sleep(backoff)
+		backoff *= 2
+		if err := r.gitClient.FetchAndReset(r.ghPagesDir, r.config.Remote, r.config.PagesBranch); err != nil {
+			return fmt.Errorf("git fetch github pages: %w", err)
+		}
+		updated, err := apply()
+		if err != nil {
+			return err
+		}
+		if !updated {
+			r.log.Info("fetched github pages index is already up to date")
+			return nil
 		}
 	}
-	return updated, nil
 }
 
-func (r Releaser) releaseChartAndUpdateIndex(ctx context.Context, chartPath string, ch *chart.Chart) (bool, error) {
-	owner, repo, err := r.gitClient.GetOwnerAndRepo(r.ghPagesDir, r.config.Remote)
+// writePagesFiles writes files generated from the index file (if enabled) to GitHub pages worktree and returns all
+// the files that should be committed together with the index file
+func (r Releaser) writePagesFiles() ([]string, error) {
+	files := []string{"index.yaml"}
+	if r.config.Page {
+		if err := r.writePage(); err != nil {
+			return nil, err
+		}
+		files = append(files, pageFileName)
+	}
+	if r.config.ArtifactHub.Enabled() {
+		if err := r.writeArtifactHubRepo(); err != nil {
+			return nil, err
+		}
+		files = append(files, artifactHubRepoFileName)
+	}
+	return files, nil
+}
+
+// releaseChart creates GitHub release, uploads chart as release asset and returns released chart. If the dry run
+// is set to true, released chart with empty asset url is returned.
+func (r Releaser) releaseChart(ctx context.Context, indexFile *repo.IndexFile, ch helm.Chart) (ReleasedChart, error) {
+	if r.config.OCIOnly {
+		ref, err := r.pushChart(ch)
+		if err != nil {
+			return ReleasedChart{}, err
+		}
+		return ReleasedChart{Chart: ch, OciRef: ref}, nil
+	}
+	if r.config.ChartMuseumOnly {
+		return r.releaseChartToChartMuseum(ch)
+	}
+	if r.config.S3.Enabled() {
+		return r.releaseChartToS3(indexFile, ch)
+	}
+
+	owner, repo, err := r.ownerAndRepo()
 	if err != nil {
-		return false, fmt.Errorf("get github owner and repo: %w", err)
+		return ReleasedChart{}, err
 	}
 
-	release := github.Release{
-		Owner:       owner,
-		Repo:        repo,
-		Tag:         r.GetReleaseTag(ch),
-		Name:        fmt.Sprintf("%s-%s", ch.Name(), ch.Metadata.Version),
-		Description: fmt.Sprintf("Kubernetes %s Helm chart", ch.Name()),
-		AssetPath:   chartPath,
-		PreRelease:  r.config.PreRelease,
+	tag, err := r.GetReleaseTag(ch.Chart)
+	if err != nil {
+		return ReleasedChart{}, err
+	}
+	forced := r.isForced(indexFile, ch)
+	description := r.config.Charts[ch.Name()].Description
+	if description == "" {
+		description = r.releaseNotes(indexFile, ch)
 	}
-	releaseId, err := r.ghClient.CreateRelease(ctx, release, r.config.DryRun)
+	release := forge.Release{
+		Owner:          owner,
+		Repo:           repo,
+		Tag:            tag,
+		Name:           fmt.Sprintf("%s-%s", ch.Name(), ch.Metadata.Version),
+		ChartName:      ch.Name(),
+		ChartVersion:   ch.Metadata.Version,
+		Description:    description,
+		AssetPath:      ch.Path,
+		ProvenancePath: ch.ProvenancePath,
+		ExtraAssets:    r.config.Charts[ch.Name()].ExtraAssets,
+		PreRelease:     r.config.PreReleaseFor(ch.Name()),
+		Force:          forced,
+	}
+	releaseId, err := r.forgeClient.CreateRelease(ctx, release, r.config.DryRun)
 	if err != nil {
-		return false, err
+		return ReleasedChart{}, err
 	}
 	// releaseId is set to 0 if dry run is set to true, upload asset would fail to get release and verify assets
 	if r.config.DryRun {
 		r.log.Info(fmt.Sprintf("%s release %s upload asset skipping, dry run is set to true", release.Name, release.Tag))
 		r.log.Info(fmt.Sprintf("update %s index skipping, dry-run set to true", r.ghPagesIndexPath))
-		return false, nil
+		return ReleasedChart{Chart: ch, Tag: release.Tag, Forced: forced}, nil
 	}
-
-	assetUrl, err := r.ghClient.UploadAsset(ctx, releaseId, release)
+	asset, err := r.forgeClient.UploadAsset(ctx, releaseId, release)
 	if err != nil {
-		return false, err
+		return ReleasedChart{}, err
 	}
+	var ref string
+	if r.config.OCI.Enabled() {
+		if ref, err = r.pushChart(ch); err != nil {
+			return ReleasedChart{}, err
+		}
+	}
+	var chartMuseumUrl string
+	if r.config.ChartMuseum.Enabled() {
+		if chartMuseumUrl, err = r.uploadToChartMuseum(ch); err != nil {
+			return ReleasedChart{}, err
+		}
+	}
+	return ReleasedChart{
+		Chart:          ch,
+		Tag:            release.Tag,
+		ReleaseId:      asset.ReleaseId,
+		ReleaseUrl:     asset.ReleaseUrl,
+		AssetUrl:       asset.AssetUrl,
+		OciRef:         ref,
+		ChartMuseumUrl: chartMuseumUrl,
+		Forced:         forced,
+	}, nil
+}
 
-	ok, err := r.helmClient.UpdateIndex(r.ghPagesIndexPath, chartPath, ch, assetUrl)
-	if err != nil {
-		return false, fmt.Errorf("update %s index file: %w", r.ghPagesIndexPath, err)
+// isForced returns true if the chart version is already in the index and force is set for the chart
+func (r Releaser) isForced(indexFile *repo.IndexFile, ch helm.Chart) bool {
+	if force, _ := r.config.ForceFor(ch.Name(), ch.Metadata.Version); !force {
+		return false
 	}
-	return ok, nil
+	return indexFile.Has(ch.Name(), ch.Metadata.Version)
 }
 
-func (r Releaser) GetReleaseTag(ch *chart.Chart) string {
-	if r.config.Tag != "" {
-		return r.config.Tag
+func indexAdded(released []ReleasedChart) bool {
+	for _, ch := range released {
+		if ch.IndexAdded {
+			return true
+		}
 	}
-	return ch.Metadata.Version
+	return false
 }
 
 func (r Releaser) addPagesWorktree() (cleanup func(), err error) {
@@ -0,0 +1,153 @@
+package hcr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ReportFormatJSON = "json"
+	ReportFormatYAML = "yaml"
+
+	ReportStatusSuccess = "success"
+	// ReportStatusPartial is set when some charts were released, but the command failed
+	ReportStatusPartial = "partial"
+	ReportStatusFailed  = "failed"
+)
+
+var ReportFormats = []string{ReportFormatJSON, ReportFormatYAML}
+
+// Report is machine-readable command result, it is printed even if the command fails
+type Report struct {
+	Command string        `json:"command"`
+	Status  string        `json:"status"`
+	Error   string        `json:"error,omitempty"`
+	Charts  []ChartReport `json:"charts"`
+}
+
+type ChartReport struct {
+	Name        string `json:"chart"`
+	Version     string `json:"version"`
+	Status      string `json:"status"`
+	SourcePath  string `json:"sourcePath,omitempty"`
+	PackagePath string `json:"packagePath,omitempty"`
+	Digest      string `json:"digest,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	ReleaseId   int64  `json:"releaseId,omitempty"`
+	ReleaseUrl  string `json:"releaseUrl,omitempty"`
+	AssetUrl    string `json:"assetUrl,omitempty"`
+	OciRef      string `json:"ociRef,omitempty"`
+	// ChartMuseumUrl is url of the chart uploaded to ChartMuseum
+	ChartMuseumUrl string `json:"chartMuseumUrl,omitempty"`
+	IndexAdded     bool   `json:"indexAdded,omitempty"`
+	Forced         bool   `json:"forced,omitempty"`
+	// Reason is set for skipped, failed, pruned charts and charts that failed verification
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewReport creates report from the command result and error
+func NewReport(command string, result Result, err error) Report {
+	report := Report{Command: command, Status: ReportStatusSuccess, Charts: []ChartReport{}}
+	if err != nil {
+		report.Error = err.Error()
+		report.Status = ReportStatusFailed
+		if len(result.Released) > 0 {
+			report.Status = ReportStatusPartial
+		}
+	}
+
+	for _, ch := range result.Released {
+		var reason string
+		if ch.Forced {
+			reason = "forced re-release, existing release asset and index entry were replaced"
+		}
+		report.Charts = append(report.Charts, ChartReport{
+			Name:           ch.Name(),
+			Version:        ch.Metadata.Version,
+			Status:         "released",
+			SourcePath:     ch.SourcePath,
+			PackagePath:    ch.Path,
+			Digest:         ch.Digest,
+			Tag:            ch.Tag,
+			ReleaseId:      ch.ReleaseId,
+			ReleaseUrl:     ch.ReleaseUrl,
+			AssetUrl:       ch.AssetUrl,
+			OciRef:         ch.OciRef,
+			ChartMuseumUrl: ch.ChartMuseumUrl,
+			IndexAdded:     ch.IndexAdded,
+			Forced:         ch.Forced,
+			Reason:         reason,
+		})
+	}
+	for _, ch := range result.Packaged {
+		report.Charts = append(report.Charts, ChartReport{
+			Name:        ch.Name(),
+			Version:     ch.Metadata.Version,
+			Status:      "packaged",
+			SourcePath:  ch.SourcePath,
+			PackagePath: ch.Path,
+			Digest:      ch.Digest,
+		})
+	}
+	for _, ch := range result.Exported {
+		report.Charts = append(report.Charts, ChartReport{
+			Name:        ch.Name(),
+			Version:     ch.Metadata.Version,
+			Status:      "exported",
+			SourcePath:  ch.SourcePath,
+			PackagePath: ch.Path,
+			Digest:      ch.Digest,
+			AssetUrl:    ch.AssetUrl,
+		})
+	}
+	for _, ch := range result.Pending {
+		report.Charts = append(report.Charts, ChartReport{Name: ch.Name, Version: ch.Version, Status: "pending", SourcePath: ch.Path})
+	}
+	for _, ch := range result.Skipped {
+		report.Charts = append(report.Charts, ChartReport{Name: ch.Name, Version: ch.Version, Status: "skipped", SourcePath: ch.Path, Reason: ch.Reason})
+	}
+	for _, ch := range result.Yanked {
+		status := "yanked"
+		if ch.Deprecated {
+			status = "deprecated"
+		}
+		report.Charts = append(report.Charts, ChartReport{Name: ch.Name, Version: ch.Version, Status: status})
+	}
+	for _, ch := range result.Verified {
+		status := "verified"
+		if ch.Problem != "" {
+			status = ch.Problem
+		}
+		report.Charts = append(report.Charts, ChartReport{Name: ch.Name, Version: ch.Version, Status: status, AssetUrl: ch.Path, Reason: ch.Reason})
+	}
+	for _, ch := range result.Pruned {
+		report.Charts = append(report.Charts, ChartReport{Name: ch.Name, Version: ch.Version, Status: "pruned", Reason: ch.Reason})
+	}
+	for _, ch := range result.Failed {
+		report.Charts = append(report.Charts, ChartReport{Name: ch.Name, Version: ch.Version, Status: "failed", SourcePath: ch.Path, Reason: ch.Reason})
+	}
+	return report
+}
+
+// Write writes report to the writer in the supplied format (json or yaml)
+func (r Report) Write(w io.Writer, format string) error {
+	var b []byte
+	var err error
+	switch format {
+	case ReportFormatJSON:
+		b, err = json.Marshal(r)
+	case ReportFormatYAML:
+		b, err = yaml.Marshal(r)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("marshal report: %w", err)
+	}
+	if _, err := fmt.Fprintln(w, string(b)); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package hcr
+
+import (
+	"fmt"
+	"time"
+)
+
+// modTime returns chart archive files modification time and index entry created time in reproducible mode. It is
+// SOURCE_DATE_EPOCH if it is set, otherwise time of the last commit that changed the chart source directory (or of the
+// HEAD commit if the chart source is unknown). Zero time (current time) is returned if reproducible mode is not set.
+func (r Releaser) modTime(chartPath string) (time.Time, error) {
+	if !r.config.Reproducible {
+		return time.Time{}, nil
+	}
+	if !r.config.SourceDateEpoch.IsZero() {
+		return r.config.SourceDateEpoch, nil
+	}
+	t, err := r.gitClient.CommitTime(chartPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("chart %s last commit time: %w", chartPath, err)
+	}
+	return t, nil
+}
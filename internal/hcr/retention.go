@@ -0,0 +1,52 @@
+package hcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/helm"
+	"path"
+)
+
+// PrunedChart is chart version removed from the index by retention policy
+type PrunedChart struct {
+	SourceChart
+	Reason string
+}
+
+func newPrunedCharts(pruned []helm.PrunedVersion) []PrunedChart {
+	var charts []PrunedChart
+	for _, p := range pruned {
+		charts = append(charts, PrunedChart{SourceChart: SourceChart{Name: p.Name, Version: p.Version}, Reason: p.Reason})
+	}
+	return charts
+}
+
+// deletePrunedReleases deletes assets (chart and provenance file) of the pruned chart versions from GitHub releases,
+// release is deleted if it has no other assets
+func (r Releaser) deletePrunedReleases(ctx context.Context, pruned []helm.PrunedVersion) error {
+	if len(pruned) == 0 {
+		return nil
+	}
+	owner, repo, err := r.ownerAndRepo()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, p := range pruned {
+		var assetNames []string
+		for _, url := range p.Urls {
+			assetNames = append(assetNames, path.Base(url), path.Base(url)+".prov")
+		}
+		tag, err := r.releaseTag(p.Name, p.Version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chart %s %s: %w", p.Name, p.Version, err))
+			continue
+		}
+		if err := r.forgeClient.DeleteReleaseAssets(ctx, owner, repo, tag, assetNames); err != nil {
+			errs = append(errs, fmt.Errorf("chart %s %s: %w", p.Name, p.Version, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,149 @@
+package hcr
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/helm"
+	"github.com/pete911/hcr/internal/s3"
+	"helm.sh/helm/v3/pkg/repo"
+	"path/filepath"
+	"time"
+)
+
+const indexFileName = "index.yaml"
+
+// contentTypes of the files uploaded to the bucket
+var contentTypes = map[string]string{
+	".yaml": "application/x-yaml",
+	".yml":  "application/x-yaml",
+	".html": "text/html; charset=utf-8",
+	".tgz":  "application/gzip",
+	".prov": "application/pgp-signature",
+}
+
+// withS3Index downloads index file from the bucket to the pages dir (if it exists) and calls fn, index etag is kept by
+// the s3 client for the conditional write
+func (r Releaser) withS3Index(fn func() (Result, error)) (Result, error) {
+	if _, err := r.s3Client.Download(indexFileName, r.ghPagesIndexPath); err != nil {
+		return Result{}, err
+	}
+	return fn()
+}
+
+// uploadChart uploads packaged chart and its provenance file to the bucket and returns chart url used in the index,
+// empty url is returned if the dry run is set to true
+func (r Releaser) uploadChart(ch helm.Chart) (string, error) {
+	fileName := filepath.Base(ch.Path)
+	if r.config.DryRun {
+		r.log.Info(fmt.Sprintf("chart %s %s upload to %s skipping, dry run is set to true", ch.Name(), ch.Metadata.Version, r.config.S3.Url))
+		return "", nil
+	}
+	if err := r.s3Client.Upload(fileName, ch.Path, contentType(fileName)); err != nil {
+		return "", err
+	}
+	// helm looks for provenance file at the chart url with .prov suffix
+	if ch.ProvenancePath != "" {
+		if err := r.s3Client.Upload(fileName+".prov", ch.ProvenancePath, contentType(ch.ProvenancePath)); err != nil {
+			return "", fmt.Errorf("upload provenance file: %w", err)
+		}
+	}
+	return r.s3Client.ChartUrl(fileName), nil
+}
+
+// releaseChartToS3 uploads chart to the bucket (and pushes it to OCI registry and uploads it to ChartMuseum if they
+// are set), there is no release
+func (r Releaser) releaseChartToS3(indexFile *repo.IndexFile, ch helm.Chart) (ReleasedChart, error) {
+	assetUrl, err := r.uploadChart(ch)
+	if err != nil {
+		return ReleasedChart{}, err
+	}
+	var ref string
+	if r.config.OCI.Enabled() {
+		if ref, err = r.pushChart(ch); err != nil {
+			return ReleasedChart{}, err
+		}
+	}
+	var chartMuseumUrl string
+	if r.config.ChartMuseum.Enabled() {
+		if chartMuseumUrl, err = r.uploadToChartMuseum(ch); err != nil {
+			return ReleasedChart{}, err
+		}
+	}
+	return ReleasedChart{Chart: ch, AssetUrl: assetUrl, OciRef: ref, ChartMuseumUrl: chartMuseumUrl, Forced: r.isForced(indexFile, ch)}, nil
+}
+
+// uploadIndex uploads index file (and files generated from it) to the bucket. Index is uploaded only if it has not been
+// modified since it was downloaded, otherwise index is downloaded again, fresh index is updated by apply and upload
+// is retried. Apply returns false if the fresh index does not need to be updated.
+func (r Releaser) uploadIndex(apply func() (bool, error)) error {
+	backoff := r.config.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		files, err := r.writePagesFiles()
+		if err != nil {
+			return err
+		}
+		err = r.s3Client.UploadIfUnchanged(indexFileName, r.ghPagesIndexPath, contentType(indexFileName))
+		if err == nil {
+			return r.uploadPagesFiles(files)
+		}
+		if !errors.Is(err, s3.ErrPreconditionFailed) || attempt > r.config.Retry.Retries {
+			return err
+		}
+
+		r.log.Warn(fmt.Sprintf("upload index attempt %d rejected, index has been modified, retrying in %s", attempt, backoff))
+		time.Sleep(backoff)
+		backoff *= 2
+		if _, err := r.s3Client.Download(indexFileName, r.ghPagesIndexPath); err != nil {
+			return err
+		}
+		updated, err := apply()
+		if err != nil {
+			return err
+		}
+		if !updated {
+			r.log.Info("downloaded index is already up to date")
+			return nil
+		}
+	}
+}
+
+// uploadPagesFiles uploads files generated from the index (landing page, Artifact Hub metadata) to the bucket
+func (r Releaser) uploadPagesFiles(files []string) error {
+	for _, file := range files {
+		if file == indexFileName {
+			continue
+		}
+		if err := r.s3Client.Upload(file, filepath.Join(r.ghPagesDir, file), contentType(file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePrunedObjects deletes charts (and provenance files) of the pruned chart versions from the bucket, only charts
+// with relative urls or urls under the public url are deleted
+func (r Releaser) deletePrunedObjects(pruned []helm.PrunedVersion) error {
+	var errs []error
+	for _, p := range pruned {
+		for _, url := range p.Urls {
+			fileName, ok := r.s3Client.ChartFileName(url)
+			if !ok {
+				r.log.Warn(fmt.Sprintf("chart %s %s url %s is not in the bucket, skipping delete", p.Name, p.Version, url))
+				continue
+			}
+			for _, name := range []string{fileName, fileName + ".prov"} {
+				if err := r.s3Client.Delete(name); err != nil {
+					errs = append(errs, fmt.Errorf("chart %s %s: %w", p.Name, p.Version, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contentType(path string) string {
+	if ct, ok := contentTypes[filepath.Ext(path)]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
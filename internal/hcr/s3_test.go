@@ -0,0 +1,158 @@
+package hcr
+
+import (
+	"github.com/pete911/hcr/internal/s3"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadIndexReappliesOnConflict(t *testing.T) {
+	tests := []struct {
+		name            string
+		updated         bool
+		expectedIndex   string
+		expectedApplied int
+	}{
+		{name: "fresh index is updated", updated: true, expectedIndex: "remote+local", expectedApplied: 1},
+		{name: "fresh index is up to date", updated: false, expectedIndex: "remote", expectedApplied: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// index is modified by another writer after it is downloaded, first upload is rejected
+			bucket := &conflictBucket{objects: map[string]string{"/bucket/index.yaml": "initial"}, conflicts: 1}
+			server := httptest.NewServer(bucket)
+			defer server.Close()
+
+			r := newS3TestReleaser(t, server.URL)
+			if _, err := r.s3Client.Download(indexFileName, r.ghPagesIndexPath); err != nil {
+				t.Fatalf("download index: %v", err)
+			}
+			writeTestFile(t, r.ghPagesIndexPath, "initial+local")
+
+			var applied int
+			apply := func() (bool, error) {
+				applied++
+				b, err := os.ReadFile(r.ghPagesIndexPath)
+				if err != nil {
+					return false, err
+				}
+				if !tt.updated {
+					return false, nil
+				}
+				writeTestFile(t, r.ghPagesIndexPath, string(b)+"+local")
+				return true, nil
+			}
+			if err := r.uploadIndex(apply); err != nil {
+				t.Fatalf("upload index: %v", err)
+			}
+			if applied != tt.expectedApplied {
+				t.Errorf("expected apply to be called %d times, got %d", tt.expectedApplied, applied)
+			}
+			if actual := bucket.get("/bucket/index.yaml"); actual != tt.expectedIndex {
+				t.Errorf("expected index %q, got %q", tt.expectedIndex, actual)
+			}
+		})
+	}
+}
+
+func TestUploadIndexRetriesExhausted(t *testing.T) {
+	bucket := &conflictBucket{objects: map[string]string{"/bucket/index.yaml": "initial"}, conflicts: 10}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	r := newS3TestReleaser(t, server.URL)
+	if _, err := r.s3Client.Download(indexFileName, r.ghPagesIndexPath); err != nil {
+		t.Fatalf("download index: %v", err)
+	}
+	if err := r.uploadIndex(func() (bool, error) { return true, nil }); err == nil {
+		t.Error("expected error when the index is modified on every attempt")
+	}
+}
+
+func newS3TestReleaser(t *testing.T, endpoint string) Releaser {
+	t.Helper()
+	config := Config{
+		S3:    s3.Config{Url: "s3://bucket", Endpoint: endpoint, PathStyle: true},
+		Retry: utils.Retry{Retries: 2, Backoff: time.Millisecond},
+	}
+	s3Client, err := s3.NewClient(zap.NewNop(), config.S3, config.Retry)
+	if err != nil {
+		t.Fatalf("new s3 client: %v", err)
+	}
+	dir := t.TempDir()
+	return Releaser{
+		s3Client:         s3Client,
+		ghPagesDir:       dir,
+		ghPagesIndexPath: filepath.Join(dir, indexFileName),
+		config:           config,
+		log:              zap.NewNop(),
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// conflictBucket is S3 stand-in that rejects conditional writes with 412 (and replaces the object with "remote"
+// content, as another writer would) until conflicts are exhausted
+type conflictBucket struct {
+	mu        sync.Mutex
+	objects   map[string]string
+	conflicts int
+	version   int
+}
+
+func (b *conflictBucket) get(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.objects[key]
+}
+
+func (b *conflictBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		content, ok := b.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", b.etag())
+		io.WriteString(w, content)
+	case http.MethodPut:
+		if r.Header.Get("If-Match") != "" && b.conflicts > 0 {
+			b.conflicts--
+			b.version++
+			b.objects[r.URL.Path] = "remote"
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != b.etag() {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		b.version++
+		b.objects[r.URL.Path] = string(body)
+		w.Header().Set("ETag", b.etag())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (b *conflictBucket) etag() string {
+	return `"` + strconv.Itoa(b.version) + `"`
+}
@@ -0,0 +1,54 @@
+package hcr
+
+import (
+	"fmt"
+	"helm.sh/helm/v3/pkg/chart"
+	"strings"
+	"text/template"
+)
+
+// tagData is data available in the release tag template e.g. '{{ .Name }}-{{ .Version }}'
+type tagData struct {
+	Name    string
+	Version string
+}
+
+// ValidateTagTemplate checks that the release tag template can be parsed and executed
+func ValidateTagTemplate(tag string) error {
+	_, err := executeTagTemplate(tag, "chart", "0.1.0")
+	return err
+}
+
+func executeTagTemplate(tag, name, version string) (string, error) {
+	t, err := template.New("tag").Option("missingkey=error").Parse(tag)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, tagData{Name: name, Version: version}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// GetReleaseTag returns release tag of the chart, defaults to chart version
+func (r Releaser) GetReleaseTag(ch *chart.Chart) (string, error) {
+	return r.releaseTag(ch.Name(), ch.Metadata.Version)
+}
+
+// releaseTag returns release tag for the chart name and version, chart config tag takes precedence over global tag
+func (r Releaser) releaseTag(name, version string) (string, error) {
+	tag := r.config.Tag
+	if chartConfig := r.config.Charts[name]; chartConfig.Tag != "" {
+		tag = chartConfig.Tag
+	}
+	if tag == "" {
+		return version, nil
+	}
+
+	out, err := executeTagTemplate(tag, name, version)
+	if err != nil {
+		return "", fmt.Errorf("release tag template %q: %w", tag, err)
+	}
+	return out, nil
+}
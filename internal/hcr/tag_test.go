@@ -0,0 +1,38 @@
+package hcr
+
+import (
+	"testing"
+)
+
+func TestReleaseTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		tag         string
+		chartTag    string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "default tag is version", expected: "1.2.3"},
+		{name: "global tag", tag: "{{ .Name }}-{{ .Version }}", expected: "app-1.2.3"},
+		{name: "chart tag takes precedence", tag: "{{ .Name }}-{{ .Version }}", chartTag: "v{{ .Version }}", expected: "v1.2.3"},
+		{name: "template execute failure", tag: "{{ .Missing }}", expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Releaser{config: Config{Tag: tt.tag, Charts: map[string]ChartConfig{"app": {Tag: tt.chartTag}}}}
+			actual, err := r.releaseTag("app", "1.2.3")
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got tag %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("release tag: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("expected tag %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
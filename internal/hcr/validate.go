@@ -0,0 +1,38 @@
+package hcr
+
+import (
+	"fmt"
+	"github.com/pete911/hcr/internal/helm"
+	"strings"
+)
+
+// validateCharts lints and renders packaged charts, if any of the charts fails, failed charts and error with report for
+// every failed chart is returned
+func (r Releaser) validateCharts(charts []helm.Chart) ([]FailedChart, error) {
+	var failed []helm.ValidationResult
+	for _, ch := range charts {
+		result := r.helmClient.ValidateChart(ch, r.config.LintStrict, r.config.Charts[ch.Name()].ValuesFiles)
+		for _, warning := range result.Warnings {
+			r.log.Warn(fmt.Sprintf("chart %s %s: %s", ch.Name(), ch.Metadata.Version, warning))
+		}
+		for _, e := range result.Errors {
+			r.log.Error(fmt.Sprintf("chart %s %s: %s", ch.Name(), ch.Metadata.Version, e))
+		}
+		if result.Failed() {
+			failed = append(failed, result)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	var failedCharts []FailedChart
+	var report []string
+	for _, result := range failed {
+		reason := strings.Join(result.Errors, "; ")
+		failedCharts = append(failedCharts, FailedChart{SourceChart: newSourceChart(result.Chart), Reason: reason})
+		report = append(report, fmt.Sprintf("%s %s (%s): %s", result.Chart.Name(), result.Chart.Metadata.Version,
+			result.Chart.SourcePath, reason))
+	}
+	return failedCharts, fmt.Errorf("%d chart(s) failed validation:\n%s", len(failed), strings.Join(report, "\n"))
+}
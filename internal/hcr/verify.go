@@ -0,0 +1,153 @@
+package hcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/forge"
+	"github.com/pete911/hcr/internal/utils"
+	"helm.sh/helm/v3/pkg/repo"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// VerifyProblemMissing index entry url does not point at existing release asset
+	VerifyProblemMissing = "missing"
+	// VerifyProblemMismatch release asset digest does not match index entry digest
+	VerifyProblemMismatch = "mismatch"
+	// VerifyProblemProvenance release asset provenance file is missing or invalid
+	VerifyProblemProvenance = "provenance"
+	// VerifyProblemOrphaned release asset (packaged chart) is not in the index
+	VerifyProblemOrphaned = "orphaned"
+)
+
+// VerifiedChart is index entry (or release asset) checked by verify command, Problem is empty if the entry is valid
+type VerifiedChart struct {
+	SourceChart
+	Problem string
+	Reason  string
+}
+
+// Verify checks that every index entry points at existing release asset with the same digest (and valid provenance
+// file if the keyring is set) and that every packaged chart release asset is in the index
+func (r Releaser) Verify(ctx context.Context) (Result, error) {
+	if r.config.S3.Enabled() {
+		return Result{}, errors.New("verify is not supported with s3 bucket, charts are not uploaded to releases")
+	}
+	return r.withPagesWorktree(func() (Result, error) {
+		indexFile, err := r.helmClient.LoadIndexFile(r.ghPagesIndexPath)
+		if err != nil {
+			return Result{}, err
+		}
+		owner, repoName, err := r.ownerAndRepo()
+		if err != nil {
+			return Result{}, err
+		}
+		assets, err := r.forgeClient.ListReleaseAssets(ctx, owner, repoName)
+		if err != nil {
+			return Result{}, err
+		}
+		downloadDir, err := os.MkdirTemp("", "hcr-assets")
+		if err != nil {
+			return Result{}, fmt.Errorf("create assets tmp dir: %w", err)
+		}
+		defer os.RemoveAll(downloadDir)
+
+		assetsByUrl := make(map[string]forge.ReleaseAsset)
+		for _, asset := range assets {
+			assetsByUrl[asset.Url] = asset
+		}
+		var chartVersions []*repo.ChartVersion
+		indexed := make(map[string]bool)
+		for _, name := range sortedKeys(indexFile.Entries) {
+			for _, cv := range indexFile.Entries[name] {
+				chartVersions = append(chartVersions, cv)
+				for _, url := range cv.URLs {
+					indexed[url] = true
+				}
+			}
+		}
+
+		verified := make([]VerifiedChart, len(chartVersions))
+		verifyErrs := make([]error, len(chartVersions))
+		utils.RunConcurrently(len(chartVersions), r.config.Concurrency, func(i int) {
+			verified[i], verifyErrs[i] = r.verifyChartVersion(ctx, owner, repoName, chartVersions[i], assetsByUrl, downloadDir)
+		})
+		// local failures are not chart problems, verify cannot tell whether the chart is valid
+		if err := errors.Join(verifyErrs...); err != nil {
+			return Result{}, err
+		}
+		for _, asset := range assets {
+			if strings.HasSuffix(asset.Name, ".tgz") && !indexed[asset.Url] {
+				source := SourceChart{Name: asset.Name, Path: asset.Url}
+				reason := fmt.Sprintf("release %s asset is not in the index", asset.ReleaseTag)
+				verified = append(verified, VerifiedChart{SourceChart: source, Problem: VerifyProblemOrphaned, Reason: reason})
+			}
+		}
+
+		var errs []error
+		for _, v := range verified {
+			if v.Problem != "" {
+				r.log.Warn(fmt.Sprintf("chart %s %s %s: %s", v.Name, v.Version, v.Problem, v.Reason))
+				errs = append(errs, fmt.Errorf("chart %s %s %s: %s", v.Name, v.Version, v.Problem, v.Reason))
+			}
+		}
+		r.log.Info(fmt.Sprintf("verified %d index entries and %d release assets, %d problems found", len(chartVersions), len(assets), len(errs)))
+		return Result{Verified: verified}, errors.Join(errs...)
+	})
+}
+
+// verifyChartVersion downloads release asset of the index entry and compares its digest with the index digest, if
+// the keyring is set, asset provenance file is verified as well. Error is returned only if the asset cannot be
+// verified because of a local failure.
+func (r Releaser) verifyChartVersion(ctx context.Context, owner, repoName string, cv *repo.ChartVersion, assets map[string]forge.ReleaseAsset, dir string) (VerifiedChart, error) {
+	verified := VerifiedChart{SourceChart: SourceChart{Name: cv.Name, Version: cv.Version}}
+	if len(cv.URLs) == 0 {
+		verified.Problem, verified.Reason = VerifyProblemMissing, "index entry has no url"
+		return verified, nil
+	}
+	verified.Path = cv.URLs[0]
+	asset, ok := assets[cv.URLs[0]]
+	if !ok {
+		verified.Problem, verified.Reason = VerifyProblemMissing, fmt.Sprintf("release asset %s does not exist", cv.URLs[0])
+		return verified, nil
+	}
+
+	// assets in different releases can have the same name
+	releaseDir := releaseAssetDir(dir, asset)
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		return verified, fmt.Errorf("chart %s %s: create download dir: %w", cv.Name, cv.Version, err)
+	}
+	path := filepath.Join(releaseDir, asset.Name)
+	if err := r.forgeClient.DownloadAsset(ctx, owner, repoName, asset, path); err != nil {
+		verified.Problem, verified.Reason = VerifyProblemMissing, fmt.Sprintf("download release asset: %v", err)
+		return verified, nil
+	}
+	digest, err := r.helmClient.Digest(path)
+	if err != nil {
+		return verified, fmt.Errorf("chart %s %s: %w", cv.Name, cv.Version, err)
+	}
+	if digest != cv.Digest {
+		verified.Problem, verified.Reason = VerifyProblemMismatch, fmt.Sprintf("index digest %s, release asset digest %s", cv.Digest, digest)
+		return verified, nil
+	}
+
+	if r.config.HelmConfig.Keyring == "" {
+		return verified, nil
+	}
+	provenanceAsset, ok := assets[asset.Url+".prov"]
+	if !ok {
+		verified.Problem, verified.Reason = VerifyProblemProvenance, fmt.Sprintf("release asset %s.prov does not exist", asset.Url)
+		return verified, nil
+	}
+	if err := r.forgeClient.DownloadAsset(ctx, owner, repoName, provenanceAsset, path+".prov"); err != nil {
+		verified.Problem, verified.Reason = VerifyProblemProvenance, fmt.Sprintf("download release asset: %v", err)
+		return verified, nil
+	}
+	if err := r.helmClient.VerifyProvenance(path, r.config.HelmConfig.Keyring); err != nil {
+		verified.Problem, verified.Reason = VerifyProblemProvenance, err.Error()
+	}
+	return verified, nil
+}
@@ -0,0 +1,83 @@
+package hcr
+
+import (
+	"context"
+	"fmt"
+)
+
+// YankConfig is chart version withdrawn by yank command
+type YankConfig struct {
+	Chart   string
+	Version string
+	// Deprecate marks the whole chart as deprecated in the index instead of removing the version
+	Deprecate bool
+	// PreRelease marks the chart version GitHub release as pre-release
+	PreRelease bool
+	// Notice is prepended to the chart version GitHub release body
+	Notice string
+}
+
+func (y YankConfig) String() string {
+	return fmt.Sprintf("chart: %q, version: %q, deprecate: %t, pre-release: %t, notice: %q", y.Chart, y.Version, y.Deprecate, y.PreRelease, y.Notice)
+}
+
+// YankedChart is chart version removed from the index, or deprecated chart
+type YankedChart struct {
+	SourceChart
+	Deprecated bool
+}
+
+// Yank removes chart version from the GitHub pages index (or marks the whole chart as deprecated) and optionally edits
+// the chart version GitHub release. Git history and GitHub releases are kept.
+func (r Releaser) Yank(ctx context.Context) (Result, error) {
+	return r.withIndexStore(func() (Result, error) {
+		yank := r.config.Yank
+		source := SourceChart{Name: yank.Chart, Version: yank.Version}
+		apply := func() (bool, error) {
+			if yank.Deprecate {
+				return r.helmClient.DeprecateChart(r.ghPagesIndexPath, yank.Chart)
+			}
+			return r.helmClient.YankChartVersion(r.ghPagesIndexPath, yank.Chart, yank.Version)
+		}
+
+		var result Result
+		updated, err := apply()
+		if err != nil {
+			return result, fmt.Errorf("update %s index file: %w", r.ghPagesIndexPath, err)
+		}
+		switch {
+		case !updated:
+			result.Skipped = append(result.Skipped, SkippedChart{SourceChart: source, Reason: "not in the index or already yanked"})
+		case r.config.DryRun:
+			r.log.Info("commit and push index skipping, dry run is set to true")
+			result.Pending = append(result.Pending, source)
+		default:
+			if err := r.storeIndex(apply); err != nil {
+				return result, err
+			}
+			r.log.Info("index updated and published")
+			result.Yanked = append(result.Yanked, YankedChart{SourceChart: source, Deprecated: yank.Deprecate})
+		}
+
+		if yank.Version == "" || (!yank.PreRelease && yank.Notice == "") {
+			return result, nil
+		}
+		if r.config.DryRun {
+			r.log.Info("edit release skipping, dry run is set to true")
+			return result, nil
+		}
+		if r.config.S3.Enabled() {
+			r.log.Warn("edit release skipping, charts published to s3 bucket have no release")
+			return result, nil
+		}
+		owner, repo, err := r.ownerAndRepo()
+		if err != nil {
+			return result, err
+		}
+		tag, err := r.releaseTag(yank.Chart, yank.Version)
+		if err != nil {
+			return result, err
+		}
+		return result, r.forgeClient.YankRelease(ctx, owner, repo, tag, yank.PreRelease, yank.Notice)
+	})
+}
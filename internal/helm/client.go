@@ -8,33 +8,60 @@ import (
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/provenance"
 	"helm.sh/helm/v3/pkg/repo"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Config struct {
-	Sign           bool
-	Key            string
-	Keyring        string
-	PassphraseFile string
+	Sign             bool
+	Key              string
+	Keyring          string
+	PassphraseFile   string
+	Dependency       string
+	RepositoryConfig string
+	RepositoryCache  string
+	// ChartKeys are signing keys overrides, map key is chart name
+	ChartKeys map[string]string
+	Retention Retention
+	// Reproducible sets index generated time to the latest chart version created time instead of the current time
+	Reproducible bool
 }
 
 func (c Config) String() string {
-	return fmt.Sprintf("sign: %t, key: %s, keyring: %s, passphrase-file: %s",
-		c.Sign, utils.SecretValue(c.Key), utils.SecretValue(c.Keyring), utils.SecretValue(c.PassphraseFile))
+	return fmt.Sprintf("sign: %t, key: %s, keyring: %s, passphrase-file: %s, dependency: %q, repository-config: %q, repository-cache: %q, retention: %s, reproducible: %t",
+		c.Sign, utils.SecretValue(c.Key), utils.SecretValue(c.Keyring), utils.SecretValue(c.PassphraseFile), c.Dependency,
+		c.RepositoryConfig, c.RepositoryCache, c.Retention, c.Reproducible)
 }
 
 type Client struct {
-	pkg *action.Package
-	log *zap.Logger
+	pkg          *action.Package
+	chartKeys    map[string]string
+	retention    Retention
+	reproducible bool
+	settings     *cli.EnvSettings
+	dependency   string
+	// dependencyMu serializes dependency builds, they share the repository cache
+	dependencyMu *sync.Mutex
+	log          *zap.Logger
 }
 
 func NewClient(log *zap.Logger, config Config) Client {
+	settings := cli.New()
+	if config.RepositoryConfig != "" {
+		settings.RepositoryConfig = config.RepositoryConfig
+	}
+	if config.RepositoryCache != "" {
+		settings.RepositoryCache = config.RepositoryCache
+	}
+
 	return Client{
 		pkg: &action.Package{
 			Sign:           config.Sign,
@@ -42,93 +69,327 @@ func NewClient(log *zap.Logger, config Config) Client {
 			Keyring:        config.Keyring,
 			PassphraseFile: config.PassphraseFile,
 		},
-		log: log,
+		chartKeys:    config.ChartKeys,
+		retention:    config.Retention,
+		reproducible: config.Reproducible,
+		settings:     settings,
+		dependency:   config.Dependency,
+		dependencyMu: &sync.Mutex{},
+		log:          log,
 	}
 }
 
-func (c Client) PackageCharts(chartsDir string) (charts map[string]*chart.Chart, cleanup func(), err error) {
+// LoadChartsMetadata walks supplied charts dir and loads 'Chart.yaml' of every chart found, returned map key is chart path
+func (c Client) LoadChartsMetadata(chartsDir string) (map[string]*chart.Metadata, error) {
 	if stat, err := os.Stat(chartsDir); err != nil || !stat.IsDir() {
-		return nil, nil, fmt.Errorf("charts dir %s does not exist", chartsDir)
+		return nil, fmt.Errorf("charts dir %s does not exist", chartsDir)
 	}
 
 	chartsPaths, err := c.getChartsPaths(chartsDir)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	var packagedChartsPaths []string
-	chs := make(map[string]*chart.Chart)
+	metadata := make(map[string]*chart.Metadata)
 	for _, chartPath := range chartsPaths {
-		packagedChartPath, ch, err := c.PackageChart(chartPath)
+		md, err := chartutil.LoadChartfile(filepath.Join(chartPath, "Chart.yaml"))
 		if err != nil {
-			return nil, nil, err
+			return nil, fmt.Errorf("load chart %s metadata: %w", chartPath, err)
+		}
+		metadata[chartPath] = md
+	}
+	return metadata, nil
+}
+
+// Chart is packaged helm chart, Path is packaged chart archive path, Digest is sha256 digest of the archive,
+// ProvenancePath is provenance file path (empty if the chart is not signed), SourcePath is the chart directory and
+// ModTime is the archive files modification time and index entry created time (zero means current time)
+type Chart struct {
+	*chart.Chart
+	Path           string
+	Digest         string
+	ProvenancePath string
+	SourcePath     string
+	ModTime        time.Time
+}
+
+// PackageOptions are chart package options, Annotations are added to the packaged chart (annotations already set in the
+// chart are not overridden) and if ModTime is set, it is used as modification time of all the archive files, so the
+// same chart content always produces the same archive. Chart is packaged to the Destination directory, or to the
+// current working directory if it is empty.
+type PackageOptions struct {
+	Annotations map[string]string
+	ModTime     time.Time
+	Destination string
+}
+
+// PackageCharts packages charts at supplied paths, at most concurrency charts are packaged at the same time. All the
+// charts are attempted, packaged charts and errors of the charts that failed are returned. Options and failed map key
+// is chart path.
+func (c Client) PackageCharts(chartsPaths []string, options map[string]PackageOptions, concurrency int) (charts []Chart, failed map[string]error, cleanup func()) {
+	packaged := make([]Chart, len(chartsPaths))
+	errs := make([]error, len(chartsPaths))
+	utils.RunConcurrently(len(chartsPaths), concurrency, func(i int) {
+		packaged[i], errs[i] = c.PackageChart(chartsPaths[i], options[chartsPaths[i]])
+	})
+
+	var chs []Chart
+	failed = make(map[string]error)
+	for i := range packaged {
+		if errs[i] != nil {
+			c.log.Error(fmt.Sprintf("package %s chart: %v", chartsPaths[i], errs[i]))
+			failed[chartsPaths[i]] = errs[i]
+			continue
 		}
-		packagedChartsPaths = append(packagedChartsPaths, packagedChartPath)
-		chs[packagedChartPath] = ch
+		chs = append(chs, packaged[i])
 	}
 
 	cleanup = func() {
-		for _, packagedChartPath := range packagedChartsPaths {
-			if err := os.Remove(packagedChartPath); err != nil {
-				c.log.Warn(fmt.Sprintf("remove %s chart: %v", packagedChartPath, err))
+		for _, ch := range chs {
+			if err := os.Remove(ch.Path); err != nil {
+				c.log.Warn(fmt.Sprintf("remove %s chart: %v", ch.Path, err))
+			}
+			c.log.Info(fmt.Sprintf("removed generated chart %s", ch.Path))
+			if ch.ProvenancePath == "" {
+				continue
 			}
-			c.log.Info(fmt.Sprintf("removed generated chart %s", packagedChartPath))
+			if err := os.Remove(ch.ProvenancePath); err != nil {
+				c.log.Warn(fmt.Sprintf("remove %s provenance file: %v", ch.ProvenancePath, err))
+			}
+			c.log.Info(fmt.Sprintf("removed generated provenance file %s", ch.ProvenancePath))
 		}
 	}
-	return chs, cleanup, nil
+
+	return chs, failed, cleanup
 }
 
-// PackageChart package given chart in current working directory (<name>-<version>.tgz) and return packaged chart
-// path and metadata
-func (c Client) PackageChart(chartPath string) (string, *chart.Chart, error) {
+// PackageChart package given chart in the destination (current working directory by default) directory
+// (<name>-<version>.tgz) and return packaged chart.
+func (c Client) PackageChart(chartPath string, options PackageOptions) (Chart, error) {
 	c.log.Info(fmt.Sprintf("start package %s chart", chartPath))
-	packagedChartPath, err := c.pkg.Run(chartPath, nil)
+	if err := c.buildDependencies(chartPath); err != nil {
+		return Chart{}, err
+	}
+	packagedChartPath, err := c.packageChart(chartPath, options)
 	if err != nil {
-		return "", nil, fmt.Errorf("package chart at %s path: %w", chartPath, err)
+		return Chart{}, fmt.Errorf("package chart at %s path: %w", chartPath, err)
 	}
 	c.log.Info(fmt.Sprintf("chart %s packaged as %s", chartPath, packagedChartPath))
 	ch, err := loader.LoadFile(packagedChartPath)
 	if err != nil {
-		return "", nil, fmt.Errorf("load chart: %w", err)
+		return Chart{}, fmt.Errorf("load chart: %w", err)
 	}
 	c.log.Info(fmt.Sprintf("chart %s loaded", ch.Name()))
-	return packagedChartPath, ch, nil
+	digest, err := provenance.DigestFile(packagedChartPath)
+	if err != nil {
+		return Chart{}, fmt.Errorf("calculate chart %s sha256 digest: %w", chartPath, err)
+	}
+
+	var provenancePath string
+	if c.pkg.Sign {
+		provenancePath = packagedChartPath + ".prov"
+		if _, err := os.Stat(provenancePath); err != nil {
+			return Chart{}, fmt.Errorf("chart %s provenance file: %w", chartPath, err)
+		}
+		c.log.Info(fmt.Sprintf("chart %s signed, provenance file %s", ch.Name(), provenancePath))
+	}
+	return Chart{Chart: ch, Path: packagedChartPath, Digest: digest, ProvenancePath: provenancePath, SourcePath: chartPath, ModTime: options.ModTime}, nil
+}
+
+// LoadPackagedCharts loads already packaged charts, provenance file is set if it exists next to the packaged chart
+func (c Client) LoadPackagedCharts(packagedChartsPaths []string) ([]Chart, error) {
+	var charts []Chart
+	for _, packagedChartPath := range packagedChartsPaths {
+		ch, err := loader.LoadFile(packagedChartPath)
+		if err != nil {
+			return nil, fmt.Errorf("load chart %s: %w", packagedChartPath, err)
+		}
+		digest, err := provenance.DigestFile(packagedChartPath)
+		if err != nil {
+			return nil, fmt.Errorf("calculate chart %s sha256 digest: %w", packagedChartPath, err)
+		}
+
+		var provenancePath string
+		if _, err := os.Stat(packagedChartPath + ".prov"); err == nil {
+			provenancePath = packagedChartPath + ".prov"
+		}
+		charts = append(charts, Chart{Chart: ch, Path: packagedChartPath, Digest: digest, ProvenancePath: provenancePath})
+		c.log.Info(fmt.Sprintf("chart %s loaded from %s", ch.Name(), packagedChartPath))
+	}
+	return charts, nil
+}
+
+// packageChart packages chart the same way as package action does, annotations are added to the packaged chart
+// metadata only, chart source is not modified
+func (c Client) packageChart(chartPath string, options PackageOptions) (string, error) {
+	pkg := c.packageAction(chartPath)
+	if options.Destination != "" {
+		destinationPkg := *pkg
+		destinationPkg.Destination = options.Destination
+		pkg = &destinationPkg
+	}
+	if len(options.Annotations) == 0 && options.ModTime.IsZero() {
+		return pkg.Run(chartPath, nil)
+	}
+
+	ch, err := loader.LoadDir(chartPath)
+	if err != nil {
+		return "", err
+	}
+	if ch.Metadata.Annotations == nil {
+		ch.Metadata.Annotations = make(map[string]string)
+	}
+	for k, v := range options.Annotations {
+		if _, ok := ch.Metadata.Annotations[k]; ok {
+			c.log.Info(fmt.Sprintf("chart %s annotation %s is already set, skipping", ch.Name(), k))
+			continue
+		}
+		ch.Metadata.Annotations[k] = v
+	}
+	if reqs := ch.Metadata.Dependencies; reqs != nil {
+		if err := action.CheckDependencies(ch, reqs); err != nil {
+			return "", err
+		}
+	}
+
+	name, err := chartutil.Save(ch, pkg.Destination)
+	if err != nil {
+		return "", fmt.Errorf("save chart: %w", err)
+	}
+	if !options.ModTime.IsZero() {
+		if err := setArchiveModTime(name, options.ModTime); err != nil {
+			return "", fmt.Errorf("set chart archive modification time: %w", err)
+		}
+	}
+	if pkg.Sign {
+		return name, pkg.Clearsign(name)
+	}
+	return name, nil
 }
 
-// UpdateIndex at the specified location with given chart. Base URL is url without chart name.
-func (c Client) UpdateIndex(indexFilePath, archiveChartPath string, chart *chart.Chart, downloadUrl string) (bool, error) {
-	indexFile, err := c.loadIndexFile(indexFilePath)
+// packageAction returns package action for the chart, signing key is overridden if it is set for the chart
+func (c Client) packageAction(chartPath string) *action.Package {
+	md, err := chartutil.LoadChartfile(filepath.Join(chartPath, "Chart.yaml"))
 	if err != nil {
-		return false, err
+		// package action fails to load the chart as well
+		return c.pkg
+	}
+	key, ok := c.chartKeys[md.Name]
+	if !ok {
+		return c.pkg
 	}
+	pkg := *c.pkg
+	pkg.Key = key
+	return &pkg
+}
 
+// AddToIndex adds packaged chart to the index file loaded in memory, download url is the chart archive url. If the
+// chart version already exists in the index, it is replaced in place only if force is set. Chart ModTime is the new
+// index entry created time, current time is used if it is zero. Chart versions removed from the index by retention
+// policy are returned. Index file is not written, see WriteIndexFile.
+func (c Client) AddToIndex(indexFile *repo.IndexFile, ch Chart, downloadUrl string, force bool) (bool, []PrunedVersion, error) {
 	// chart already exists in the index
-	if _, err := indexFile.Get(chart.Name(), chart.Metadata.Version); err == nil {
-		c.log.Info(fmt.Sprintf("chart %s %s already exists in the helm index", chart.Name(), chart.Metadata.Version))
-		return false, nil
+	existing, err := indexFile.Get(ch.Name(), ch.Metadata.Version)
+	if err == nil && !force {
+		c.log.Info(fmt.Sprintf("chart %s %s already exists in the helm index", ch.Name(), ch.Metadata.Version))
+		return false, nil, nil
+	}
+
+	fileName := filepath.Base(ch.Path)
+	baseUrl := strings.TrimSuffix(downloadUrl, fileName)
+	if existing != nil {
+		c.log.Warn(fmt.Sprintf("chart %s %s already exists in the helm index, force is set, replacing index entry digest %s with %s",
+			ch.Name(), ch.Metadata.Version, existing.Digest, ch.Digest))
+		removeChartVersion(indexFile, existing)
+	}
+	if err := indexFile.MustAdd(ch.Metadata, fileName, baseUrl, ch.Digest); err != nil {
+		return false, nil, err
+	}
+	added, _ := indexFile.Get(ch.Name(), ch.Metadata.Version)
+	// helm joins the base url path, which decodes escaped characters (GitLab url encoded project path)
+	if downloadUrl != "" {
+		added.URLs = []string{downloadUrl}
 	}
+	if !ch.ModTime.IsZero() {
+		added.Created = ch.ModTime
+	}
+	// replaced entry keeps its position in the history
+	if existing != nil {
+		added.Created = existing.Created
+	}
+	pruned := pruneIndex(indexFile, c.retention, added, time.Now())
+	for _, p := range pruned {
+		c.log.Info(fmt.Sprintf("chart %s %s removed from the helm index: %s", p.Name, p.Version, p.Reason))
+	}
+	return true, pruned, nil
+}
 
-	digest, err := provenance.DigestFile(archiveChartPath)
+func removeChartVersion(indexFile *repo.IndexFile, cv *repo.ChartVersion) {
+	var chartVersions repo.ChartVersions
+	for _, v := range indexFile.Entries[cv.Name] {
+		if v != cv {
+			chartVersions = append(chartVersions, v)
+		}
+	}
+	indexFile.Entries[cv.Name] = chartVersions
+}
+
+// PrunedVersions returns chart versions that would be removed from the index by retention policy after the supplied
+// (not yet released) charts are added, index file is not updated
+func (c Client) PrunedVersions(indexFilePath string, charts []*chart.Metadata) ([]PrunedVersion, error) {
+	indexFile, err := c.LoadIndexFile(indexFilePath)
 	if err != nil {
-		return false, fmt.Errorf("calculate chart sha256 digest: %w", err)
+		return nil, err
+	}
+	for _, md := range charts {
+		if err := indexFile.MustAdd(md, fmt.Sprintf("%s-%s.tgz", md.Name, md.Version), "", ""); err != nil {
+			return nil, fmt.Errorf("add chart %s %s to the index: %w", md.Name, md.Version, err)
+		}
 	}
+	return pruneIndex(indexFile, c.retention, nil, time.Now()), nil
+}
+
+// IndexChart is packaged chart with its download url and time when it was created
+type IndexChart struct {
+	Chart
+	Url     string
+	Created time.Time
+}
 
-	baseUrl := strings.TrimSuffix(downloadUrl, archiveChartPath)
-	if err := indexFile.MustAdd(chart.Metadata, archiveChartPath, baseUrl, digest); err != nil {
-		return false, err
+// RebuildIndex replaces index file at the specified location with new index file containing supplied charts. Created
+// timestamp is preserved for charts that are in the existing index file (if it can be loaded), otherwise chart created
+// time is used. If the chart version is supplied more than once, the first one is used.
+func (c Client) RebuildIndex(indexFilePath string, charts []IndexChart) error {
+	existingIndexFile, err := c.LoadIndexFile(indexFilePath)
+	if err != nil {
+		c.log.Warn(fmt.Sprintf("existing index file cannot be loaded, created timestamps are not preserved: %v", err))
+		existingIndexFile = repo.NewIndexFile()
 	}
 
-	indexFile.SortEntries()
-	indexFile.Generated = time.Now()
+	indexFile := repo.NewIndexFile()
+	for _, ch := range charts {
+		if indexFile.Has(ch.Name(), ch.Metadata.Version) {
+			c.log.Warn(fmt.Sprintf("chart %s %s from %s already added to the index, skipping", ch.Name(), ch.Metadata.Version, ch.Url))
+			continue
+		}
 
-	if err := indexFile.WriteFile(indexFilePath, 0644); err != nil {
-		return false, err
+		fileName := filepath.Base(ch.Path)
+		baseUrl := strings.TrimSuffix(ch.Url, fileName)
+		if err := indexFile.MustAdd(ch.Metadata, fileName, baseUrl, ch.Digest); err != nil {
+			return fmt.Errorf("add chart %s %s to the index: %w", ch.Name(), ch.Metadata.Version, err)
+		}
+		chartVersion, _ := indexFile.Get(ch.Name(), ch.Metadata.Version)
+		chartVersion.Created = ch.Created
+		if existing, err := existingIndexFile.Get(ch.Name(), ch.Metadata.Version); err == nil {
+			chartVersion.Created = existing.Created
+		}
 	}
-	return true, nil
+
+	return c.WriteIndexFile(indexFile, indexFilePath)
 }
 
-// loadIndexFile loads index file from specified file path, if the file does not exist, new index is returned
-func (c Client) loadIndexFile(filePath string) (*repo.IndexFile, error) {
+// LoadIndexFile loads index file from specified file path, if the file does not exist, new index is returned
+func (c Client) LoadIndexFile(filePath string) (*repo.IndexFile, error) {
 	if _, err := os.Stat(filePath); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			c.log.Info(fmt.Sprintf("creating new index file, %s does not exist", filePath))
@@ -145,6 +406,36 @@ func (c Client) loadIndexFile(filePath string) (*repo.IndexFile, error) {
 	return indexFile, nil
 }
 
+// WriteIndexFile validates index entries, sorts them, sets generated time and writes the index file atomically, the
+// existing index file is not modified if any of the entries is invalid. In reproducible mode, generated time is the
+// latest created time of the index entries, so the same entries always produce the same index file.
+func (c Client) WriteIndexFile(indexFile *repo.IndexFile, indexFilePath string) error {
+	for _, name := range sortedEntries(indexFile) {
+		for _, cv := range indexFile.Entries[name] {
+			if err := cv.Validate(); err != nil {
+				return fmt.Errorf("index entry %s %s: %w", name, cv.Version, err)
+			}
+			if len(cv.URLs) == 0 {
+				return fmt.Errorf("index entry %s %s: no urls", name, cv.Version)
+			}
+		}
+	}
+
+	indexFile.SortEntries()
+	indexFile.Generated = time.Now()
+	if c.reproducible {
+		indexFile.Generated = time.Time{}
+		for _, chartVersions := range indexFile.Entries {
+			for _, cv := range chartVersions {
+				if cv.Created.After(indexFile.Generated) {
+					indexFile.Generated = cv.Created
+				}
+			}
+		}
+	}
+	return indexFile.WriteFile(indexFilePath, 0644)
+}
+
 // getChartsPaths walks supplied charts dir recursively and returns parent directories of all 'Chart.yaml' files
 func (c Client) getChartsPaths(chartsDir string) ([]string, error) {
 	var paths []string
@@ -0,0 +1,82 @@
+package helm
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DependencyBuild  = "build"
+	DependencyUpdate = "update"
+	DependencyNone   = "none"
+)
+
+var DependencyModes = []string{DependencyBuild, DependencyUpdate, DependencyNone}
+
+// buildDependencies builds (respects Chart.lock) or updates chart dependencies in the chart 'charts' directory,
+// depending on the configured dependency mode. Charts without dependencies are skipped.
+func (c Client) buildDependencies(chartPath string) error {
+	if c.dependency == DependencyNone {
+		return nil
+	}
+
+	md, err := chartutil.LoadChartfile(filepath.Join(chartPath, "Chart.yaml"))
+	if err != nil {
+		return fmt.Errorf("load chart %s metadata: %w", chartPath, err)
+	}
+	if len(md.Dependencies) == 0 {
+		return nil
+	}
+	c.dependencyMu.Lock()
+	defer c.dependencyMu.Unlock()
+
+	registryClient, err := registry.NewClient(registry.ClientOptWriter(logWriter{log: c.log}))
+	if err != nil {
+		return fmt.Errorf("new registry client: %w", err)
+	}
+	man := &downloader.Manager{
+		Out:              logWriter{log: c.log},
+		ChartPath:        chartPath,
+		Keyring:          c.pkg.Keyring,
+		Getters:          getter.All(c.settings),
+		RegistryClient:   registryClient,
+		RepositoryConfig: c.settings.RepositoryConfig,
+		RepositoryCache:  c.settings.RepositoryCache,
+	}
+
+	if c.dependency == DependencyUpdate {
+		c.log.Info(fmt.Sprintf("update %s chart dependencies", chartPath))
+		if err := man.Update(); err != nil {
+			return fmt.Errorf("update %s chart dependencies: %w", chartPath, err)
+		}
+		return nil
+	}
+
+	c.log.Info(fmt.Sprintf("build %s chart dependencies", chartPath))
+	if err := man.Build(); err != nil {
+		if strings.Contains(err.Error(), "out of sync") {
+			return fmt.Errorf("build %s chart dependencies, lock file is out of date (update it or use %s dependency mode): %w",
+				chartPath, DependencyUpdate, err)
+		}
+		return fmt.Errorf("build %s chart dependencies: %w", chartPath, err)
+	}
+	return nil
+}
+
+// logWriter writes helm output as info log messages
+type logWriter struct {
+	log *zap.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	if msg := strings.TrimSpace(string(p)); msg != "" {
+		w.log.Info(msg)
+	}
+	return len(p), nil
+}
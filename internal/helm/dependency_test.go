@@ -0,0 +1,159 @@
+package helm
+
+import (
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBuildDependencies(t *testing.T) {
+	chartRepo := newTestChartRepository(t)
+	server := httptest.NewServer(chartRepo)
+	defer server.Close()
+	chartRepo.add(t, server.URL, "dep", "1.0.0")
+
+	dir := t.TempDir()
+	repositoryConfig := filepath.Join(dir, "repositories.yaml")
+	writeFile(t, repositoryConfig, "apiVersion: v1\nrepositories:\n  - name: test\n    url: "+server.URL+"\n")
+	config := Config{RepositoryConfig: repositoryConfig, RepositoryCache: filepath.Join(dir, "cache")}
+
+	chartDir := filepath.Join(dir, "app")
+	writeFile(t, filepath.Join(chartDir, "Chart.yaml"), "apiVersion: v2\nname: app\nversion: 1.0.0\n"+
+		"dependencies:\n  - name: dep\n    version: ^1.0.0\n    repository: "+server.URL+"\n")
+
+	// update resolves dependencies and writes lock file
+	if err := newDependencyClient(config, DependencyUpdate).buildDependencies(chartDir); err != nil {
+		t.Fatalf("update dependencies: %v", err)
+	}
+	assertDependencies(t, chartDir, "dep-1.0.0.tgz")
+	if _, err := os.Stat(filepath.Join(chartDir, "Chart.lock")); err != nil {
+		t.Fatalf("expected lock file to be written: %v", err)
+	}
+
+	// new version matching the dependency range is released
+	chartRepo.add(t, server.URL, "dep", "1.1.0")
+
+	// build respects the lock file
+	removeDependencies(t, chartDir)
+	if err := newDependencyClient(config, DependencyBuild).buildDependencies(chartDir); err != nil {
+		t.Fatalf("build dependencies: %v", err)
+	}
+	assertDependencies(t, chartDir, "dep-1.0.0.tgz")
+
+	// none does not touch dependencies
+	removeDependencies(t, chartDir)
+	if err := newDependencyClient(config, DependencyNone).buildDependencies(chartDir); err != nil {
+		t.Fatalf("none dependencies: %v", err)
+	}
+	assertDependencies(t, chartDir)
+
+	// update re-resolves dependencies
+	if err := newDependencyClient(config, DependencyUpdate).buildDependencies(chartDir); err != nil {
+		t.Fatalf("update dependencies: %v", err)
+	}
+	assertDependencies(t, chartDir, "dep-1.1.0.tgz")
+
+	// dependencies changed after the lock file was written
+	writeFile(t, filepath.Join(chartDir, "Chart.yaml"), "apiVersion: v2\nname: app\nversion: 1.0.0\n"+
+		"dependencies:\n  - name: dep\n    version: ~1.0.0\n    repository: "+server.URL+"\n")
+	err := newDependencyClient(config, DependencyBuild).buildDependencies(chartDir)
+	if err == nil || !strings.Contains(err.Error(), "lock file is out of date") {
+		t.Fatalf("expected lock file is out of date error, got %v", err)
+	}
+}
+
+func TestBuildDependenciesFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "local", "Chart.yaml"), "apiVersion: v2\nname: local\nversion: 0.1.0\n")
+	chartDir := filepath.Join(dir, "app")
+	writeFile(t, filepath.Join(chartDir, "Chart.yaml"), "apiVersion: v2\nname: app\nversion: 1.0.0\n"+
+		"dependencies:\n  - name: local\n    version: 0.1.0\n    repository: file://../local\n")
+
+	config := Config{RepositoryConfig: filepath.Join(dir, "repositories.yaml"), RepositoryCache: filepath.Join(dir, "cache")}
+	if err := newDependencyClient(config, DependencyBuild).buildDependencies(chartDir); err != nil {
+		t.Fatalf("build dependencies: %v", err)
+	}
+	assertDependencies(t, chartDir, "local-0.1.0.tgz")
+}
+
+func newDependencyClient(config Config, dependency string) Client {
+	config.Dependency = dependency
+	return NewClient(zap.NewNop(), config)
+}
+
+func assertDependencies(t *testing.T, chartDir string, expected ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(chartDir, "charts"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, entry := range entries {
+		actual = append(actual, entry.Name())
+	}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected dependencies %v, got %v", expected, actual)
+	}
+}
+
+func removeDependencies(t *testing.T, chartDir string) {
+	t.Helper()
+	if err := os.RemoveAll(filepath.Join(chartDir, "charts")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testChartRepository is helm chart repository stand-in, it serves index.yaml and chart archives
+type testChartRepository struct {
+	mu    sync.Mutex
+	dir   string
+	index *repo.IndexFile
+}
+
+func newTestChartRepository(t *testing.T) *testChartRepository {
+	return &testChartRepository{dir: t.TempDir(), index: repo.NewIndexFile()}
+}
+
+// add packages chart with the name and version and adds it to the repository index
+func (r *testChartRepository) add(t *testing.T, url, name, version string) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	md := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version}
+	archivePath, err := chartutil.Save(&chart.Chart{Metadata: md}, r.dir)
+	if err != nil {
+		t.Fatalf("save chart: %v", err)
+	}
+	digest, err := provenance.DigestFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.index.MustAdd(md, filepath.Base(archivePath), url, digest); err != nil {
+		t.Fatal(err)
+	}
+	r.index.SortEntries()
+}
+
+func (r *testChartRepository) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.URL.Path == "/index.yaml" {
+		indexPath := filepath.Join(r.dir, "index.yaml")
+		if err := r.index.WriteFile(indexPath, 0644); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeFile(w, req, indexPath)
+		return
+	}
+	http.ServeFile(w, req, filepath.Join(r.dir, filepath.Base(req.URL.Path)))
+}
@@ -0,0 +1,57 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// setArchiveModTime rewrites chart archive with modification time of every file set to modTime, so the archive (and
+// its digest) depends only on the chart content
+func setArchiveModTime(archivePath string, modTime time.Time) error {
+	b, err := os.ReadFile(archivePath)
+	if err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	var out bytes.Buffer
+	zw := gzip.NewWriter(&out)
+	zw.Header = zr.Header
+	tr := tar.NewReader(zr)
+	tw := tar.NewWriter(zw)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+		header.ModTime = modTime.UTC().Truncate(time.Second)
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(archivePath, out.Bytes(), 0644)
+}
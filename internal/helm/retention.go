@@ -0,0 +1,138 @@
+package helm
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/repo"
+	"sort"
+	"time"
+)
+
+const (
+	KeepLatestPerMajor = "major"
+	KeepLatestPerMinor = "minor"
+)
+
+var KeepLatestPer = []string{KeepLatestPerMajor, KeepLatestPerMinor}
+
+// Retention configures which chart versions are kept in the index, zero value keeps all the versions
+type Retention struct {
+	// KeepLast is number of the latest versions kept per chart, 0 keeps all the versions
+	KeepLast int
+	// KeepLatestPer keeps the latest version of every major or minor version, even if it is not in the last versions
+	KeepLatestPer string
+	// PreReleaseMaxAge removes pre-release versions older than max age, 0 keeps all the pre-release versions
+	PreReleaseMaxAge time.Duration
+}
+
+func (r Retention) Enabled() bool {
+	return r.KeepLast > 0 || r.PreReleaseMaxAge > 0
+}
+
+func (r Retention) String() string {
+	return fmt.Sprintf("keep-last: %d, keep-latest-per: %q, pre-release-max-age: %s", r.KeepLast, r.KeepLatestPer, r.PreReleaseMaxAge)
+}
+
+// PrunedVersion is chart version removed from the index by retention policy
+type PrunedVersion struct {
+	Name    string
+	Version string
+	Urls    []string
+	Reason  string
+}
+
+// pruneIndex removes chart versions from the index according to the retention policy and returns removed versions.
+// Protected chart version is never removed. Versions that are not valid semver are kept.
+func pruneIndex(indexFile *repo.IndexFile, retention Retention, protected *repo.ChartVersion, now time.Time) []PrunedVersion {
+	if !retention.Enabled() {
+		return nil
+	}
+
+	var pruned []PrunedVersion
+	for _, name := range sortedEntries(indexFile) {
+		var kept repo.ChartVersions
+		var versions []*semver.Version
+		var chartVersions repo.ChartVersions
+		for _, cv := range indexFile.Entries[name] {
+			v, err := semver.NewVersion(cv.Version)
+			if err != nil {
+				kept = append(kept, cv)
+				continue
+			}
+			versions = append(versions, v)
+			chartVersions = append(chartVersions, cv)
+		}
+		// the latest version first
+		sort.Sort(byVersionDesc{versions: versions, chartVersions: chartVersions})
+
+		latestPer := make(map[string]bool)
+		var count int
+		for i, cv := range chartVersions {
+			v := versions[i]
+			group := retention.group(v)
+			latestInGroup := group != "" && !latestPer[group] && v.Prerelease() == ""
+			if latestInGroup {
+				latestPer[group] = true
+			}
+
+			reason := retention.pruneReason(v, cv, count, latestInGroup, now)
+			if reason == "" || isProtected(cv, protected) {
+				kept = append(kept, cv)
+				count++
+				continue
+			}
+			pruned = append(pruned, PrunedVersion{Name: cv.Name, Version: cv.Version, Urls: cv.URLs, Reason: reason})
+		}
+		indexFile.Entries[name] = kept
+	}
+	indexFile.SortEntries()
+	return pruned
+}
+
+// pruneReason returns reason why the chart version should be removed, or empty string if the version is kept. Count
+// is number of the newer versions that are kept.
+func (r Retention) pruneReason(v *semver.Version, cv *repo.ChartVersion, count int, latestInGroup bool, now time.Time) string {
+	if v.Prerelease() != "" && r.PreReleaseMaxAge > 0 && now.Sub(cv.Created) > r.PreReleaseMaxAge {
+		return fmt.Sprintf("pre-release older than %s", r.PreReleaseMaxAge)
+	}
+	if r.KeepLast > 0 && count >= r.KeepLast && !latestInGroup {
+		return fmt.Sprintf("not in the last %d versions", r.KeepLast)
+	}
+	return ""
+}
+
+// group returns major or minor version group of the version, or empty string if latest per group is not kept
+func (r Retention) group(v *semver.Version) string {
+	switch r.KeepLatestPer {
+	case KeepLatestPerMajor:
+		return fmt.Sprintf("%d", v.Major())
+	case KeepLatestPerMinor:
+		return fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+	}
+	return ""
+}
+
+func isProtected(cv, protected *repo.ChartVersion) bool {
+	return protected != nil && cv.Name == protected.Name && cv.Version == protected.Version
+}
+
+func sortedEntries(indexFile *repo.IndexFile) []string {
+	var names []string
+	for name := range indexFile.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type byVersionDesc struct {
+	versions      []*semver.Version
+	chartVersions repo.ChartVersions
+}
+
+func (b byVersionDesc) Len() int           { return len(b.versions) }
+func (b byVersionDesc) Less(i, j int) bool { return b.versions[i].GreaterThan(b.versions[j]) }
+func (b byVersionDesc) Swap(i, j int) {
+	b.versions[i], b.versions[j] = b.versions[j], b.versions[i]
+	b.chartVersions[i], b.chartVersions[j] = b.chartVersions[j], b.chartVersions[i]
+}
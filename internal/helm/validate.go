@@ -0,0 +1,115 @@
+package helm
+
+import (
+	"fmt"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/lint/support"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// ValuesFilesGlob is glob (relative to the chart directory) of extra values files that chart is validated with
+const ValuesFilesGlob = "ci/*-values.yaml"
+
+type ValidationResult struct {
+	Chart    Chart
+	Errors   []string
+	Warnings []string
+}
+
+func (v ValidationResult) Failed() bool {
+	return len(v.Errors) > 0
+}
+
+// ValidateChart lints and renders packaged chart with default values, with every extra values file found in the chart
+// source directory and with the configured values files (relative to the chart source directory). If strict is set to
+// true, lint warnings are reported as errors.
+func (c Client) ValidateChart(ch Chart, strict bool, configuredValuesFiles []string) ValidationResult {
+	result := ValidationResult{Chart: ch}
+	valuesFiles, err := filepath.Glob(filepath.Join(ch.SourcePath, ValuesFilesGlob))
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: glob values files: %v", ValuesFilesGlob, err))
+	}
+	sort.Strings(valuesFiles)
+	for _, valuesFile := range configuredValuesFiles {
+		if !filepath.IsAbs(valuesFile) {
+			valuesFile = filepath.Join(ch.SourcePath, valuesFile)
+		}
+		if slices.Contains(valuesFiles, valuesFile) {
+			continue
+		}
+		// missing file is reported when the values are read
+		valuesFiles = append(valuesFiles, valuesFile)
+	}
+
+	// empty values file means default values
+	for _, valuesFile := range append([]string{""}, valuesFiles...) {
+		values := chartutil.Values{}
+		source := "default values"
+		if valuesFile != "" {
+			var err error
+			source = valuesFile
+			if values, err = chartutil.ReadValuesFile(valuesFile); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: read values: %v", source, err))
+				continue
+			}
+		}
+
+		errs, warnings := c.lint(ch, values, strict)
+		for _, e := range errs {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: lint: %s", source, e))
+		}
+		for _, w := range warnings {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: lint: %s", source, w))
+		}
+		if err := c.render(ch, values); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: render: %v", source, err))
+		}
+	}
+	c.log.Info(fmt.Sprintf("chart %s validated, errors: %d, warnings: %d", ch.Name(), len(result.Errors), len(result.Warnings)))
+	return result
+}
+
+// lint runs helm lint action and returns errors and (non-blocking) warnings
+func (c Client) lint(ch Chart, values chartutil.Values, strict bool) ([]string, []string) {
+	lint := action.NewLint()
+	lint.Strict = strict
+	result := lint.Run([]string{ch.Path}, values)
+
+	var errs, warnings []string
+	for _, err := range result.Errors {
+		errs = append(errs, err.Error())
+	}
+	if !strict {
+		for _, msg := range result.Messages {
+			if msg.Severity == support.WarningSev {
+				warnings = append(warnings, msg.Error())
+			}
+		}
+	}
+	return errs, warnings
+}
+
+// render renders chart templates the same way as 'helm template' does, without connecting to the cluster
+func (c Client) render(ch Chart, values chartutil.Values) error {
+	// load new copy of the chart, processing dependencies modifies the chart
+	renderChart, err := loader.LoadFile(ch.Path)
+	if err != nil {
+		return fmt.Errorf("load chart: %w", err)
+	}
+	if err := chartutil.ProcessDependenciesWithMerge(renderChart, values); err != nil {
+		return err
+	}
+
+	options := chartutil.ReleaseOptions{Name: "release-name", Namespace: "default", Revision: 1, IsInstall: true}
+	renderValues, err := chartutil.ToRenderValues(renderChart, values, options, chartutil.DefaultCapabilities.Copy())
+	if err != nil {
+		return err
+	}
+	_, err = engine.Render(renderChart, renderValues)
+	return err
+}
@@ -0,0 +1,78 @@
+package helm
+
+import (
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateChart(t *testing.T) {
+	chartDir := filepath.Join(t.TempDir(), "app")
+	writeFile(t, filepath.Join(chartDir, "Chart.yaml"), "apiVersion: v2\nname: app\nversion: 1.0.0\n")
+	writeFile(t, filepath.Join(chartDir, "values.yaml"), "fail: false\n")
+	writeFile(t, filepath.Join(chartDir, "templates", "cm.yaml"), `{{ if .Values.fail }}{{ fail "values fail" }}{{ end }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+`)
+	writeFile(t, filepath.Join(chartDir, "ci", "ok-values.yaml"), "fail: false\n")
+	writeFile(t, filepath.Join(chartDir, "examples", "ok-values.yaml"), "fail: false\n")
+	writeFile(t, filepath.Join(chartDir, "examples", "fail-values.yaml"), "fail: true\n")
+
+	chdir(t, t.TempDir())
+	client := NewClient(zap.NewNop(), Config{Dependency: DependencyNone})
+	ch, err := client.PackageChart(chartDir, PackageOptions{})
+	if err != nil {
+		t.Fatalf("package chart: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		valuesFiles    []string
+		expectedErrors []string
+	}{
+		{name: "default and ci values"},
+		{name: "configured values file", valuesFiles: []string{"examples/ok-values.yaml"}},
+		{name: "configured values file fails render", valuesFiles: []string{"examples/fail-values.yaml"}, expectedErrors: []string{"fail-values.yaml: render"}},
+		{name: "configured values file is missing", valuesFiles: []string{"examples/missing-values.yaml"}, expectedErrors: []string{"missing-values.yaml: read values"}},
+		{name: "configured ci values file is not duplicated", valuesFiles: []string{"ci/ok-values.yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := client.ValidateChart(ch, false, tt.valuesFiles)
+			if len(result.Errors) != len(tt.expectedErrors) {
+				t.Fatalf("expected %d errors, got %v", len(tt.expectedErrors), result.Errors)
+			}
+			for i, expected := range tt.expectedErrors {
+				if !strings.Contains(result.Errors[i], expected) {
+					t.Errorf("expected error containing %q, got %q", expected, result.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -0,0 +1,26 @@
+package helm
+
+import (
+	"fmt"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// Digest returns sha256 digest of the packaged chart
+func (c Client) Digest(packagedChartPath string) (string, error) {
+	digest, err := provenance.DigestFile(packagedChartPath)
+	if err != nil {
+		return "", fmt.Errorf("calculate chart sha256 digest: %w", err)
+	}
+	return digest, nil
+}
+
+// VerifyProvenance verifies packaged chart against its provenance file (packaged chart path with .prov suffix) and
+// the public keyring
+func (c Client) VerifyProvenance(packagedChartPath, keyring string) error {
+	if _, err := downloader.VerifyChart(packagedChartPath, keyring); err != nil {
+		return err
+	}
+	c.log.Info(fmt.Sprintf("chart %s provenance verified", packagedChartPath))
+	return nil
+}
@@ -0,0 +1,54 @@
+package helm
+
+import (
+	"fmt"
+)
+
+// YankChartVersion removes chart version from the index file, false is returned if the version is not in the index
+func (c Client) YankChartVersion(indexFilePath, name, version string) (bool, error) {
+	indexFile, err := c.LoadIndexFile(indexFilePath)
+	if err != nil {
+		return false, err
+	}
+	cv, err := indexFile.Get(name, version)
+	if err != nil || cv.Version != version {
+		c.log.Info(fmt.Sprintf("chart %s %s is not in the helm index", name, version))
+		return false, nil
+	}
+
+	removeChartVersion(indexFile, cv)
+	if len(indexFile.Entries[name]) == 0 {
+		delete(indexFile.Entries, name)
+	}
+	if err := c.WriteIndexFile(indexFile, indexFilePath); err != nil {
+		return false, err
+	}
+	c.log.Info(fmt.Sprintf("chart %s %s removed from the helm index", name, version))
+	return true, nil
+}
+
+// DeprecateChart marks all the chart versions in the index file as deprecated, false is returned if the chart is not
+// in the index or all the versions are already deprecated
+func (c Client) DeprecateChart(indexFilePath, name string) (bool, error) {
+	indexFile, err := c.LoadIndexFile(indexFilePath)
+	if err != nil {
+		return false, err
+	}
+
+	var updated bool
+	for _, cv := range indexFile.Entries[name] {
+		if !cv.Deprecated {
+			cv.Deprecated = true
+			updated = true
+		}
+	}
+	if !updated {
+		c.log.Info(fmt.Sprintf("chart %s is not in the helm index or it is already deprecated", name))
+		return false, nil
+	}
+	if err := c.WriteIndexFile(indexFile, indexFilePath); err != nil {
+		return false, err
+	}
+	c.log.Info(fmt.Sprintf("chart %s deprecated in the helm index", name))
+	return true, nil
+}
@@ -0,0 +1,159 @@
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/registry"
+	orasauth "oras.land/oras-go/pkg/auth"
+	dockerauth "oras.land/oras-go/pkg/auth/docker"
+	"os"
+	"strings"
+	"time"
+)
+
+// Scheme is OCI registry url scheme used by helm e.g. oci://ghcr.io/owner/charts
+const Scheme = "oci://"
+
+type Config struct {
+	// Registry is OCI registry and namespace charts are pushed to e.g. oci://ghcr.io/owner/charts
+	Registry string
+	Username string
+	Password string
+	// PlainHTTP uses http instead of https, e.g. for local registries
+	PlainHTTP bool
+}
+
+func (c Config) Enabled() bool {
+	return c.Registry != ""
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("registry: %q, username: %q, password: %s, plain-http: %t", c.Registry, c.Username, utils.SecretValue(c.Password), c.PlainHTTP)
+}
+
+type Client struct {
+	registry *registry.Client
+	// resolver resolves chart references, registry client does not expose typed (not found) errors
+	resolver   remotes.Resolver
+	repository string
+	log        *zap.Logger
+}
+
+// NewClient returns OCI registry client. If the username is set, registry is authenticated with the username and
+// password, otherwise credentials stored by 'helm registry login' (or 'docker login') are used.
+func NewClient(log *zap.Logger, config Config) (Client, error) {
+	repository := strings.TrimSuffix(strings.TrimPrefix(config.Registry, Scheme), "/")
+	options := []registry.ClientOption{registry.ClientOptEnableCache(true)}
+	var resolverOptions []orasauth.ResolverOption
+	if config.PlainHTTP {
+		options = append(options, registry.ClientOptPlainHTTP())
+		resolverOptions = append(resolverOptions, orasauth.WithResolverPlainHTTP())
+	}
+	// same default as the registry client
+	credentialsFile := helmpath.ConfigPath(registry.CredentialsFileBasename)
+	if config.Username != "" {
+		var err error
+		credentialsFile, err = writeCredentialsFile(strings.Split(repository, "/")[0], config.Username, config.Password)
+		if err != nil {
+			return Client{}, fmt.Errorf("write registry credentials: %w", err)
+		}
+		// credentials are loaded when the clients are created
+		defer os.Remove(credentialsFile)
+		options = append(options, registry.ClientOptCredentialsFile(credentialsFile))
+	}
+
+	registryClient, err := registry.NewClient(options...)
+	if err != nil {
+		return Client{}, fmt.Errorf("new registry client: %w", err)
+	}
+	authClient, err := dockerauth.NewClientWithDockerFallback(credentialsFile)
+	if err != nil {
+		return Client{}, fmt.Errorf("new registry auth client: %w", err)
+	}
+	resolver, err := authClient.ResolverWithOpts(resolverOptions...)
+	if err != nil {
+		return Client{}, fmt.Errorf("new registry resolver: %w", err)
+	}
+	return Client{registry: registryClient, resolver: resolver, repository: repository, log: log}, nil
+}
+
+// PushedChart is chart pushed to OCI registry, Ref is chart reference e.g. oci://ghcr.io/owner/charts/app:1.0.0
+type PushedChart struct {
+	Ref    string
+	Digest string
+}
+
+// Push pushes packaged chart (and provenance file if the path is set) to the registry as <registry>/<name>:<version>.
+// Created is manifest creation time annotation, current time is used if it is zero.
+func (c Client) Push(name, version, archivePath, provenancePath string, created time.Time) (PushedChart, error) {
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		return PushedChart{}, fmt.Errorf("read chart: %w", err)
+	}
+	var options []registry.PushOption
+	if provenancePath != "" {
+		provData, err := os.ReadFile(provenancePath)
+		if err != nil {
+			return PushedChart{}, fmt.Errorf("read provenance file: %w", err)
+		}
+		options = append(options, registry.PushOptProvData(provData))
+	}
+	if !created.IsZero() {
+		options = append(options, registry.PushOptCreationTime(created.UTC().Format(time.RFC3339)))
+	}
+
+	ref := c.ref(name, version)
+	result, err := c.registry.Push(data, ref, options...)
+	if err != nil {
+		return PushedChart{}, fmt.Errorf("push %s: %w", ref, err)
+	}
+	c.log.Info(fmt.Sprintf("chart %s %s pushed to %s, digest %s", name, version, ref, result.Manifest.Digest))
+	return PushedChart{Ref: Scheme + ref, Digest: result.Manifest.Digest}, nil
+}
+
+// Exists returns true if the chart version is already pushed to the registry
+func (c Client) Exists(name, version string) (bool, error) {
+	ref := fmt.Sprintf("%s/%s:%s", c.repository, name, tag(version))
+	if _, _, err := c.resolver.Resolve(context.Background(), ref); err != nil {
+		// chart repository or tag does not exist yet
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("resolve %s: %w", ref, err)
+	}
+	return true, nil
+}
+
+func (c Client) ref(name, version string) string {
+	return fmt.Sprintf("%s/%s:%s", c.repository, name, version)
+}
+
+// tag returns OCI tag of the chart version, helm stores + (semver build metadata) as _, because + is not allowed in tags
+func tag(version string) string {
+	return strings.ReplaceAll(version, "+", "_")
+}
+
+// writeCredentialsFile writes docker config file with the registry credentials to temp dir and returns its path
+func writeCredentialsFile(host, username, password string) (string, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	b, err := json.Marshal(map[string]any{"auths": map[string]any{host: map[string]string{"auth": auth}}})
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "hcr-registry-config")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
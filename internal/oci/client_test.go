@@ -0,0 +1,63 @@
+package oci
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExists(t *testing.T) {
+	manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/", "/v2/charts/app/manifests/1.0.0", "/v2/charts/app/manifests/1.1.0_build.1":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+			w.Header().Set("Content-Length", strconv.Itoa(len(manifest)))
+			if r.Method == http.MethodGet {
+				w.Write([]byte(manifest))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	client, err := NewClient(zap.NewNop(), Config{Registry: Scheme + host + "/charts", PlainHTTP: true})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		chart    string
+		version  string
+		expected bool
+	}{
+		{name: "pushed version", chart: "app", version: "1.0.0", expected: true},
+		{name: "pushed version with build metadata", chart: "app", version: "1.1.0+build.1", expected: true},
+		{name: "not pushed version", chart: "app", version: "2.0.0", expected: false},
+		{name: "not pushed chart", chart: "other", version: "1.0.0", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := client.Exists(tt.chart, tt.version)
+			if err != nil {
+				t.Fatalf("exists: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTag(t *testing.T) {
+	if actual := tag("1.0.0+build.1"); actual != "1.0.0_build.1" {
+		t.Errorf("expected 1.0.0_build.1, got %s", actual)
+	}
+}
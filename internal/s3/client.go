@@ -0,0 +1,421 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/pete911/hcr/internal/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Scheme        = "s3://"
+	DefaultRegion = "us-east-1"
+	httpTimeout   = 5 * time.Minute
+)
+
+// ErrPreconditionFailed is returned when the conditional write fails, because the object has been modified (or
+// created) since it was downloaded
+var ErrPreconditionFailed = errors.New("object has been modified since it was downloaded")
+
+// Config is S3-compatible bucket charts and index are uploaded to. PublicUrl is url the bucket prefix is served on, it
+// is used for chart urls in the index, urls are relative to the index if it is empty.
+type Config struct {
+	// Url is s3://<bucket>/<prefix>
+	Url string
+	// Endpoint defaults to AWS S3 regional endpoint, e.g. http://localhost:9000 for MinIO
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// PathStyle uses <endpoint>/<bucket>/<key> urls instead of virtual-hosted <bucket>.<endpoint host>/<key>
+	PathStyle bool
+	PublicUrl string
+}
+
+func (c Config) Enabled() bool {
+	return c.Url != ""
+}
+
+// BucketAndPrefix returns bucket and prefix (without leading and trailing slash) parsed from the url
+func (c Config) BucketAndPrefix() (string, string, error) {
+	if !strings.HasPrefix(c.Url, Scheme) {
+		return "", "", fmt.Errorf("s3 url %q has to start with %s", c.Url, Scheme)
+	}
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(c.Url, Scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("s3 url %q does not contain bucket", c.Url)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("url: %q, endpoint: %q, region: %q, access-key: %q, secret-key: %s, path-style: %t, public-url: %q",
+		c.Url, c.Endpoint, c.Region, c.AccessKey, utils.SecretValue(c.SecretKey), c.PathStyle, c.PublicUrl)
+}
+
+type Client struct {
+	config      Config
+	bucket      string
+	prefix      string
+	endpoint    *url.URL
+	httpClient  *http.Client
+	retryConfig utils.Retry
+	// etags are etags of downloaded objects (empty if the object did not exist), used by conditional writes
+	etags *etags
+	log   *zap.Logger
+}
+
+type etags struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func NewClient(log *zap.Logger, config Config, retryConfig utils.Retry) (Client, error) {
+	bucket, prefix, err := config.BucketAndPrefix()
+	if err != nil {
+		return Client{}, err
+	}
+	if config.Region == "" {
+		config.Region = DefaultRegion
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return Client{}, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+	return Client{
+		config:      config,
+		bucket:      bucket,
+		prefix:      prefix,
+		endpoint:    u,
+		httpClient:  &http.Client{Timeout: httpTimeout},
+		retryConfig: retryConfig,
+		etags:       &etags{values: make(map[string]string)},
+		log:         log,
+	}, nil
+}
+
+// ChartUrl returns url of the chart file in the index, public url is used if it is set, otherwise the url is relative
+// to the index file
+func (c Client) ChartUrl(fileName string) string {
+	if c.config.PublicUrl == "" {
+		return fileName
+	}
+	return strings.TrimSuffix(c.config.PublicUrl, "/") + "/" + fileName
+}
+
+// ChartFileName returns chart file name (relative to the prefix) of the index chart url, false is returned if the url
+// does not point at the bucket prefix
+func (c Client) ChartFileName(chartUrl string) (string, bool) {
+	name := chartUrl
+	if c.config.PublicUrl != "" {
+		var ok bool
+		if name, ok = strings.CutPrefix(chartUrl, strings.TrimSuffix(c.config.PublicUrl, "/")+"/"); !ok {
+			return "", false
+		}
+	}
+	if name == "" || strings.Contains(name, "/") || strings.Contains(name, ":") {
+		return "", false
+	}
+	return name, true
+}
+
+// Download downloads object (name is relative to the prefix) to the path and remembers its etag, false is returned
+// if the object does not exist (conditional write then expects that the object still does not exist)
+func (c Client) Download(name, filePath string) (bool, error) {
+	ctx := context.Background()
+	var body []byte
+	var etag string
+	var found bool
+	err := c.retry(ctx, fmt.Sprintf("download %s", c.uri(name)), func() error {
+		resp, err := c.do(ctx, http.MethodGet, name, nil, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			found = false
+			return nil
+		}
+		if err := checkResponse(resp); err != nil {
+			return err
+		}
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return err
+		}
+		etag, found = resp.Header.Get("ETag"), true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("download %s: %w", c.uri(name), err)
+	}
+	c.setETag(name, etag)
+	if !found {
+		c.log.Info(fmt.Sprintf("%s does not exist", c.uri(name)))
+		// previously downloaded object could have been deleted
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		return false, nil
+	}
+	if err := os.WriteFile(filePath, body, 0644); err != nil {
+		return false, err
+	}
+	c.log.Info(fmt.Sprintf("downloaded %s etag %s", c.uri(name), etag))
+	return true, nil
+}
+
+// Upload uploads file to the object (name is relative to the prefix), existing object is replaced
+func (c Client) Upload(name, filePath, contentType string) error {
+	if err := c.upload(name, filePath, contentType, nil); err != nil {
+		return err
+	}
+	c.log.Info(fmt.Sprintf("uploaded %s", c.uri(name)))
+	return nil
+}
+
+// UploadIfUnchanged uploads file to the object only if the object has not been modified since it was downloaded
+// (If-Match with downloaded etag, or If-None-Match if the object did not exist). ErrPreconditionFailed is returned if
+// the object has been modified.
+func (c Client) UploadIfUnchanged(name, filePath, contentType string) error {
+	etag, ok := c.getETag(name)
+	if !ok {
+		return fmt.Errorf("upload %s: object has not been downloaded", c.uri(name))
+	}
+	header := http.Header{"If-None-Match": {"*"}}
+	if etag != "" {
+		header = http.Header{"If-Match": {etag}}
+	}
+	if err := c.upload(name, filePath, contentType, header); err != nil {
+		return err
+	}
+	if etag == "" {
+		c.log.Info(fmt.Sprintf("uploaded new %s", c.uri(name)))
+		return nil
+	}
+	c.log.Info(fmt.Sprintf("uploaded %s, previous etag %s", c.uri(name), etag))
+	return nil
+}
+
+func (c Client) upload(name, filePath, contentType string, header http.Header) error {
+	ctx := context.Background()
+	body, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", contentType)
+
+	var etag string
+	err = c.retry(ctx, fmt.Sprintf("upload %s", c.uri(name)), func() error {
+		resp, err := c.do(ctx, http.MethodPut, name, header, body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		// 409 is returned by AWS S3 if there is concurrent conditional write in progress
+		if resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict {
+			return ErrPreconditionFailed
+		}
+		if err := checkResponse(resp); err != nil {
+			return err
+		}
+		etag = resp.Header.Get("ETag")
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", c.uri(name), err)
+	}
+	c.setETag(name, etag)
+	return nil
+}
+
+// Delete deletes object (name is relative to the prefix), missing object is not an error
+func (c Client) Delete(name string) error {
+	ctx := context.Background()
+	err := c.retry(ctx, fmt.Sprintf("delete %s", c.uri(name)), func() error {
+		resp, err := c.do(ctx, http.MethodDelete, name, nil, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return checkResponse(resp)
+	})
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", c.uri(name), err)
+	}
+	c.log.Info(fmt.Sprintf("deleted %s", c.uri(name)))
+	return nil
+}
+
+func (c Client) setETag(name, etag string) {
+	c.etags.mu.Lock()
+	defer c.etags.mu.Unlock()
+	c.etags.values[name] = etag
+}
+
+func (c Client) getETag(name string) (string, bool) {
+	c.etags.mu.Lock()
+	defer c.etags.mu.Unlock()
+	etag, ok := c.etags.values[name]
+	return etag, ok
+}
+
+// uri returns s3://<bucket>/<key> of the object, used in logs and errors
+func (c Client) uri(name string) string {
+	return Scheme + c.bucket + "/" + c.key(name)
+}
+
+func (c Client) key(name string) string {
+	return path.Join(c.prefix, name)
+}
+
+// objectUrl returns path-style or virtual-hosted url of the object
+func (c Client) objectUrl(name string) *url.URL {
+	u := *c.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if c.config.PathStyle {
+		u.Path = basePath + "/" + c.bucket + "/" + c.key(name)
+	} else {
+		u.Host = c.bucket + "." + u.Host
+		u.Path = basePath + "/" + c.key(name)
+	}
+	u.RawPath = encodePath(u.Path)
+	return &u
+}
+
+// do sends signed request (anonymous if the access key is not set), body is nil for requests without body
+func (c Client) do(ctx context.Context, method, name string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectUrl(name).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.config.AccessKey != "" {
+		c.sign(req, body, time.Now().UTC())
+	}
+	return c.httpClient.Do(req)
+}
+
+// sign signs the request with AWS signature version 4, payload is signed as well
+func (c Client) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.config.SessionToken)
+	}
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	if c.config.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+		canonicalHeaders += fmt.Sprintf("x-amz-security-token:%s\n", c.config.SessionToken)
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, c.config.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := hmacSha256([]byte("AWS4"+c.config.SecretKey), date)
+	key = hmacSha256(key, c.config.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// encodePath escapes everything except unreserved characters and slash, as required by signature version 4
+func encodePath(p string) string {
+	var sb strings.Builder
+	for _, b := range []byte(p) {
+		if b == '/' || b == '-' || b == '_' || b == '.' || b == '~' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') {
+			sb.WriteByte(b)
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%%%02X", b))
+	}
+	return sb.String()
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// apiError is non-2xx S3 response
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// checkResponse returns api error if the response status is not 2xx, message is S3 xml error body
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &apiError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+}
+
+// retry calls fn until it succeeds, returns error that is not transient or retries are exhausted
+func (c Client) retry(ctx context.Context, operation string, fn func() error) error {
+	return c.retryConfig.Do(ctx, c.log, operation, fn, isTransientError)
+}
+
+// isTransientError returns true for errors that can succeed on retry - server errors, throttling and network errors
+func isTransientError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrPreconditionFailed) {
+		return false, 0
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests, 0
+	}
+	// network errors, timeouts ...
+	return true, 0
+}
@@ -0,0 +1,26 @@
+package utils
+
+import "sync"
+
+// RunConcurrently calls fn for every index from 0 to n-1, with at most concurrency calls running at the same time.
+// It returns once all the calls are finished.
+func RunConcurrently(n, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Retry configures how many times failed (transient error) API call is retried, backoff is doubled after every retry.
+type Retry struct {
+	Retries int
+	Backoff time.Duration
+}
+
+func (r Retry) String() string {
+	return fmt.Sprintf("retries: %d, backoff: %s", r.Retries, r.Backoff)
+}
+
+// Do calls fn until it succeeds, returns error that is not transient or retries are exhausted. transient returns
+// whether the error can succeed on retry and the minimum wait (e.g. rate limit retry after) before the next attempt.
+func (r Retry) Do(ctx context.Context, log *zap.Logger, operation string, fn func() error, transient func(error) (bool, time.Duration)) error {
+	backoff := r.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > r.Retries {
+			return err
+		}
+		ok, minWait := transient(err)
+		if !ok {
+			return err
+		}
+
+		wait := max(backoff, minWait)
+		log.Warn(fmt.Sprintf("%s attempt %d failed, retrying in %s: %v", operation, attempt, wait, err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	goflag "flag"
 	"fmt"
 	"github.com/pete911/hcr/internal/flag"
 	"github.com/pete911/hcr/internal/hcr"
@@ -20,37 +21,70 @@ func main() {
 		os.Exit(1)
 	}
 
-	config, err := flag.ParseFlags()
+	command, config, err := flag.ParseFlags()
 	if err != nil {
-		return
+		if errors.Is(err, goflag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	if config.Version {
+	if command == flag.CommandVersion || config.Version {
 		fmt.Println(Version)
 		os.Exit(0)
 	}
 
-	log.Info(config.String())
+	log.Info(fmt.Sprintf("command: %s, %s", command, config))
 	releaser, err := hcr.NewReleaser(log, config)
 	if err != nil {
+		// report is written on error as well, downstream jobs read the status from it
+		if err := writeReport(config, hcr.NewReport(command, hcr.Result{}, err)); err != nil {
+			log.Error(fmt.Sprintf("report: %v", err))
+		}
 		log.Fatal(fmt.Sprintf("new releaser: %v", err))
 	}
 
-	chs, err := releaser.Release(context.TODO())
-	if err != nil {
-		log.Fatal(fmt.Sprintf("release: %v", err))
+	var result hcr.Result
+	var commandErr error
+	switch command {
+	case flag.CommandRelease:
+		result, commandErr = releaser.Release(context.TODO())
+	case flag.CommandPackage:
+		result, commandErr = releaser.Package()
+	case flag.CommandIndex:
+		result, commandErr = releaser.Index(context.TODO())
+	case flag.CommandIndexRebuild:
+		result, commandErr = releaser.RebuildIndex(context.TODO())
+	case flag.CommandVerify:
+		result, commandErr = releaser.Verify(context.TODO())
+	case flag.CommandYank:
+		result, commandErr = releaser.Yank(context.TODO())
+	case flag.CommandStatus:
+		result, commandErr = releaser.Status()
+	case flag.CommandExport:
+		result, commandErr = releaser.Export()
 	}
 
-	// print released charts
-	var out []map[string]string
-	for _, ch := range chs {
-		out = append(out, map[string]string{"chart": ch.Name(), "version": ch.Metadata.Version, "tag": releaser.GetReleaseTag(ch)})
+	// print report, even if some of the charts failed to release
+	if err := writeReport(config, hcr.NewReport(command, result, commandErr)); err != nil {
+		log.Error(fmt.Sprintf("report: %v", err))
 	}
-	b, err := json.Marshal(out)
-	if err != nil {
-		log.Error(fmt.Sprintf("marshal released charts info: %v", err))
-		return
+
+	if commandErr != nil {
+		log.Fatal(fmt.Sprintf("%s: %v", command, commandErr))
+	}
+}
+
+// writeReport writes report to the report file, or to stdout if the report file is not set
+func writeReport(config hcr.Config, report hcr.Report) error {
+	if config.ReportFile == "" {
+		return report.Write(os.Stdout, config.ReportFormat)
 	}
-	if b != nil {
-		fmt.Println(string(b))
+
+	f, err := os.Create(config.ReportFile)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+	return report.Write(f, config.ReportFormat)
 }